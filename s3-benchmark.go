@@ -5,20 +5,32 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/md5"
 	"crypto/sha1"
+	"crypto/subtle"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"io/ioutil"
 	"log"
+	"math"
+	"math/bits"
 	"math/rand"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
 	"os"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
@@ -28,6 +40,7 @@ import (
 
 	"code.cloudfoundry.org/bytefmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -48,6 +61,89 @@ var (
 	endTime, uploadFinish, downloadFinish, deleteFinish, listVerFinish, listObjFinish time.Time
 
 	uploadSlowdownCount, downloadSlowdownCount, deleteSlowdownCount, listVerSlowdownCount, listObjSlowdownCount int32
+
+	uploadLatency, downloadLatency latencyHistogram
+	downloadErrorCount             int32
+
+	headCount, headSlowdownCount, headErrorCount int32
+	headFinish                                   time.Time
+	headLatency                                  latencyHistogram
+
+	copyBucket                                   string
+	copyPartSize                                 uint64
+	copyCount, copySlowdownCount, copyErrorCount int32
+	copyFinish                                   time.Time
+	copyLatency                                  latencyHistogram
+
+	deleteBatch                                    int
+	multiDeleteCount, multiDeleteRequests          int32
+	multiDeleteSlowdownCount, multiDeleteKeyErrors int32
+	multiDeleteFinish                              time.Time
+	multiDeleteLatency                             latencyHistogram
+
+	versionDepth, versionKeys                                int
+	versionIds                                               [][]string
+	versionMu                                                sync.Mutex
+	versionPutCount, versionGetCount, versionListCount       int32
+	versionDeleteCount, versionErrorCount                    int32
+	versionListRows                                          int64
+	versionPutLatency, versionGetLatency, versionListLatency latencyHistogram
+	versionMarkerLatency, versionDeleteLatency               latencyHistogram
+
+	consistency                      bool
+	consistencyWait, consistencyPoll time.Duration
+	consistencyCount                 int32
+
+	phases map[string]bool
+
+	rampOp, rampBy                               string
+	rampStart, rampStep, rampSteps, rampHoldSecs int
+	rampThroughputGain, rampLatencyGrowth        float64
+	opPacer                                      *pacer
+
+	keyDist, hotspotArg string
+	zipfSkew            float64
+	getPicker           keyPicker
+
+	keyScheme, keyTemplate  string
+	keyPrefixLen, keyLevels int
+	keyFanout               int
+	keyDateStep             time.Duration
+	keySalt                 uint64
+	keyEpoch                time.Time
+	objectKey               keyNamer
+
+	useDataset     bool
+	datasetObjects int32
+
+	balanceMode      string
+	resolveEndpoints bool
+	balancer         *endpointBalancer
+
+	traceRequests bool
+	monitor       *clientMonitor
+
+	agentListen, agentsArg, agentToken string
+
+	keepAlive, useHTTP2, compression bool
+	maxConns, maxIdleConns           int
+	idleTimeout                      time.Duration
+	readBuffer, writeBuffer          uint64
+	connPool                         string
+	threadClients                    = map[int]*http.Client{}
+	threadClientsMu                  sync.Mutex
+
+	uploadRate, downloadRate             uint64
+	threadUploadRate, threadDownloadRate uint64
+	uploadLimit, downloadLimit           *throttle
+	threadLimits                         = map[int][2]*throttle{}
+	threadThrottlesMu                    sync.Mutex
+
+	tlsVerify, tlsTickets                             bool
+	tlsCA, tlsCert, tlsKey, tlsMinVersion, tlsCiphers string
+	tlsConfig                                         *tls.Config
+	tlsHandshakes, tlsResumed, tlsErrors              int32
+	tlsLatency                                        latencyHistogram
 )
 
 func logit(msg string) {
@@ -59,27 +155,723 @@ func logit(msg string) {
 	}
 }
 
-// Our HTTP transport used for the roundtripper below
-var HTTPTransport http.RoundTripper = &http.Transport{
-	Proxy: http.ProxyFromEnvironment,
-	Dial: (&net.Dialer{
-		Timeout:   30 * time.Second,
-		KeepAlive: 30 * time.Second,
-	}).Dial,
-	TLSHandshakeTimeout:   10 * time.Second,
-	ExpectContinueTimeout: 0,
-	// Allow an unlimited number of idle connections
-	MaxIdleConnsPerHost: 4096,
-	MaxIdleConns:        0,
-	// But limit their idle time
-	IdleConnTimeout: time.Minute,
-	// Ignore TLS errors
-	TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+// byteRate -- bytes for a B/sec rate, 0 instead of bytefmt's 0B
+func byteRate(bytes float64) string {
+	if bytes < 1 {
+		return "0"
+	}
+	return bytefmt.ByteSize(uint64(bytes))
+}
+
+// Our HTTP transport used for the roundtripper below, set up by main from the flags
+var HTTPTransport http.RoundTripper
+
+var httpClient = &http.Client{}
+
+func newDialer() *net.Dialer {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !keepAlive {
+		dialer.KeepAlive = -1
+	}
+	return dialer
+}
+
+// newTransport -- an HTTP transport with its own connection pool from the transport and TLS flags
+func newTransport() *http.Transport {
+	dialer := newDialer()
+	config := tlsConfig.Clone()
+	// Clone shares the session cache, a pool of its own resumes only its own sessions
+	if config.ClientSessionCache != nil {
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+	if useHTTP2 {
+		config.NextProtos = []string{"h2", "http/1.1"}
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		DialTLSContext:        tlsDialer(config, dialer.DialContext),
+		TLSClientConfig:       config,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 0,
+		// Allow an unlimited number of idle connections by default
+		MaxIdleConnsPerHost: maxIdleConns,
+		MaxIdleConns:        0,
+		MaxConnsPerHost:     maxConns,
+		// But limit their idle time
+		IdleConnTimeout:    idleTimeout,
+		DisableKeepAlives:  !keepAlive,
+		DisableCompression: !compression,
+		ReadBufferSize:     int(readBuffer),
+		WriteBufferSize:    int(writeBuffer),
+		// HTTP/2 is negotiated over TLS only
+		ForceAttemptHTTP2: useHTTP2,
+	}
+}
+
+// threadHTTPClient -- the client of a thread, every thread has its own connection pool with -pool thread
+func threadHTTPClient(thread_num int) *http.Client {
+	if connPool != "thread" {
+		return httpClient
+	}
+	threadClientsMu.Lock()
+	defer threadClientsMu.Unlock()
+	client, ok := threadClients[thread_num]
+	if !ok {
+		client = &http.Client{Transport: newTransport()}
+		if balancer != nil {
+			client.Transport = balancer.dedicated(client.Transport.(*http.Transport))
+		}
+		threadClients[thread_num] = client
+	}
+	return client
+}
+
+// endpoint -- one gateway node and its statistics
+type endpoint struct {
+	name, addr, serverName      string
+	outstanding                 int32
+	requests, errors, slowdowns int32
+	bytes                       int64
+	latency                     latencyHistogram
+}
+
+// endpointBalancer -- spreads the requests of all clients over the endpoints, URLs, Host header and
+// signatures stay the ones of the first -u endpoint, only the address dialed changes
+type endpointBalancer struct {
+	endpoints  []*endpoint
+	transports []http.RoundTripper
+	mode       string
+	next       uint32
+	since      time.Time
+}
+
+// newEndpointBalancer -- one endpoint per URL, or per A/AAAA record of each URL host with resolve
+func newEndpointBalancer(urls []string, resolve bool, mode string, base *http.Transport) (*endpointBalancer, error) {
+	if mode != "rr" && mode != "least" && mode != "hash" {
+		return nil, fmt.Errorf("unknown balancing %q, expecting rr, least or hash", mode)
+	}
+	b := &endpointBalancer{mode: mode, since: time.Now()}
+	seen := map[string]bool{}
+	var scheme string
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint %q", raw)
+		}
+		if scheme == "" {
+			scheme = u.Scheme
+		} else if u.Scheme != scheme {
+			return nil, fmt.Errorf("endpoint %q does not use %s like the first one", raw, scheme)
+		}
+		port := u.Port()
+		if port == "" {
+			port = "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+		}
+		hosts := []string{u.Hostname()}
+		if resolve {
+			if hosts, err = net.LookupHost(u.Hostname()); err != nil {
+				return nil, fmt.Errorf("resolving %s: %v", u.Hostname(), err)
+			}
+		}
+		for _, host := range hosts {
+			addr := net.JoinHostPort(host, port)
+			if seen[addr] {
+				continue
+			}
+			seen[addr] = true
+			// Named nodes present their own name, resolved addresses the one of the URL
+			serverName := ""
+			if net.ParseIP(host) == nil {
+				serverName = host
+			}
+			b.endpoints = append(b.endpoints, &endpoint{name: addr, addr: addr, serverName: serverName})
+		}
+	}
+	b.transports = b.newTransports(base)
+	return b, nil
+}
+
+// newTransports -- a copy of base for each endpoint, always dialing that endpoint
+func (b *endpointBalancer) newTransports(base *http.Transport) []http.RoundTripper {
+	transports := []http.RoundTripper{}
+	for _, e := range b.endpoints {
+		addr, dialer := e.addr, newDialer()
+		transport := base.Clone()
+		transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		if e.serverName != "" {
+			transport.TLSClientConfig.ServerName = e.serverName
+		}
+		transport.DialTLSContext = tlsDialer(transport.TLSClientConfig, transport.DialContext)
+		transports = append(transports, transport)
+	}
+	return transports
+}
+
+// dedicated -- a balancer over the same endpoints and statistics, with connection pools of its own
+func (b *endpointBalancer) dedicated(base *http.Transport) *endpointBalancer {
+	return &endpointBalancer{endpoints: b.endpoints, transports: b.newTransports(base), mode: b.mode}
+}
+
+func (b *endpointBalancer) pick(req *http.Request) int {
+	n := uint32(len(b.endpoints))
+	switch b.mode {
+	case "least":
+		// Start at the next round-robin position so ties spread evenly
+		first := atomic.AddUint32(&b.next, 1)
+		best := first % n
+		for i := uint32(1); i < n; i++ {
+			if atomic.LoadInt32(&b.endpoints[(first+i)%n].outstanding) < atomic.LoadInt32(&b.endpoints[best].outstanding) {
+				best = (first + i) % n
+			}
+		}
+		return int(best)
+	case "hash":
+		h := fnv.New32a()
+		h.Write([]byte(req.URL.Path))
+		return int(h.Sum32() % n)
+	}
+	return int((atomic.AddUint32(&b.next, 1) - 1) % n)
+}
+
+func (b *endpointBalancer) RoundTrip(req *http.Request) (*http.Response, error) {
+	n := b.pick(req)
+	e := b.endpoints[n]
+	atomic.AddInt32(&e.outstanding, 1)
+	atomic.AddInt32(&e.requests, 1)
+	if req.ContentLength > 0 {
+		atomic.AddInt64(&e.bytes, req.ContentLength)
+	}
+	start := time.Now()
+	resp, err := b.transports[n].RoundTrip(req)
+	if err != nil {
+		atomic.AddInt32(&e.outstanding, -1)
+		atomic.AddInt32(&e.errors, 1)
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		atomic.AddInt32(&e.slowdowns, 1)
+	} else if resp.StatusCode >= 500 {
+		atomic.AddInt32(&e.errors, 1)
+	}
+	body := &endpointBody{ReadCloser: resp.Body, endpoint: e, start: start}
+	// Not every caller drains or closes empty bodies, the request is done with the headers
+	if resp.ContentLength == 0 || req.Method == "HEAD" {
+		body.finish()
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// endpointBody -- a request is outstanding and its latency runs until the body is drained or closed
+type endpointBody struct {
+	io.ReadCloser
+	endpoint *endpoint
+	start    time.Time
+	done     int32
+}
+
+func (b *endpointBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	atomic.AddInt64(&b.endpoint.bytes, int64(n))
+	if err != nil {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *endpointBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+func (b *endpointBody) finish() {
+	if atomic.CompareAndSwapInt32(&b.done, 0, 1) {
+		atomic.AddInt32(&b.endpoint.outstanding, -1)
+		b.endpoint.latency.record(time.Since(b.start))
+	}
+}
+
+// reset -- start counting the endpoints anew, no-op without a balancer
+func (b *endpointBalancer) reset() {
+	if b == nil {
+		return
+	}
+	for _, e := range b.endpoints {
+		atomic.StoreInt32(&e.requests, 0)
+		atomic.StoreInt32(&e.errors, 0)
+		atomic.StoreInt32(&e.slowdowns, 0)
+		atomic.StoreInt64(&e.bytes, 0)
+		e.latency.reset()
+	}
+	b.since = time.Now()
+}
+
+// report -- log the endpoints since the last report and reset them, endpoints with errors, slowdowns or
+// twice the median latency are marked, no-op without a balancer
+func (b *endpointBalancer) report(label string) {
+	if b == nil {
+		return
+	}
+	secs := time.Since(b.since).Seconds()
+	// Endpoints without requests in the phase have no latency to compare
+	means := []time.Duration{}
+	for _, e := range b.endpoints {
+		if atomic.LoadInt64(&e.latency.count) > 0 {
+			means = append(means, e.latency.mean())
+		}
+	}
+	sort.Slice(means, func(i, j int) bool { return means[i] < means[j] })
+	var median time.Duration
+	if len(means) > 0 {
+		median = means[len(means)/2]
+	}
+	for _, e := range b.endpoints {
+		requests := atomic.LoadInt32(&e.requests)
+		errors, slowdowns := atomic.LoadInt32(&e.errors), atomic.LoadInt32(&e.slowdowns)
+		speed := byteRate(float64(atomic.LoadInt64(&e.bytes)) / secs)
+		mark := ""
+		if errors > 0 || slowdowns > 0 || e.latency.mean() > 2*median {
+			mark = " <- check"
+		}
+		logit(fmt.Sprintf("%s endpoint %s: requests = %d, %.1f requests/sec, speed = %sB/sec, latency avg = %s, p99 = %s. Slowdowns = %d, Errors = %d%s",
+			label, e.name, requests, float64(requests)/secs, speed,
+			e.latency.mean(), e.latency.percentile(99), slowdowns, errors, mark))
+	}
+	b.reset()
+}
+
+// traceStats -- where the time of the requests of one operation went, from net/http/httptrace
+type traceStats struct {
+	requests, reused, dials                  int32
+	dns, connect, tls, write, ttfb, transfer latencyHistogram
+}
+
+var traceOps = []string{"PUT", "GET", "HEAD", "COPY", "LIST2", "LISTver", "DELETE", "MULTIDELETE"}
+
+var traces = func() map[string]*traceStats {
+	traces := map[string]*traceStats{}
+	for _, op := range traceOps {
+		traces[op] = &traceStats{}
+	}
+	return traces
+}()
+
+// requestTrace -- the phase timestamps of one request, nil unless -trace
+type requestTrace struct {
+	stats                            *traceStats
+	mutex                            sync.Mutex
+	dnsStart, connectStart, tlsStart time.Time
+	gotConn, wrote, firstByte        time.Time
+	dns, connect, tls                time.Duration
+	dialed, reused                   bool
+}
+
+func newTrace(op string) *requestTrace {
+	if !traceRequests {
+		return nil
+	}
+	return &requestTrace{stats: traces[op]}
+}
+
+// at -- callbacks of a dial can still run after the request got another connection
+func (t *requestTrace) at(update func(now time.Time)) {
+	now := time.Now()
+	t.mutex.Lock()
+	update(now)
+	t.mutex.Unlock()
+}
+
+// context -- for the aws-sdk WithContext calls
+func (t *requestTrace) context() context.Context {
+	if t == nil {
+		return context.Background()
+	}
+	return httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.at(func(now time.Time) { t.dnsStart = now }) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.at(func(now time.Time) { t.dns = now.Sub(t.dnsStart) }) },
+		ConnectStart: func(string, string) {
+			t.at(func(now time.Time) { t.connectStart = now })
+		},
+		ConnectDone: func(string, string, error) {
+			t.at(func(now time.Time) { t.connect, t.dialed = now.Sub(t.connectStart), true })
+		},
+		TLSHandshakeStart: func() { t.at(func(now time.Time) { t.tlsStart = now }) },
+		// Sums up, the transport repeats the hooks around tlsDialer's handshake
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.at(func(now time.Time) { t.tls += now.Sub(t.tlsStart) })
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.at(func(now time.Time) { t.gotConn, t.reused = now, info.Reused })
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.at(func(now time.Time) { t.wrote = now }) },
+		GotFirstResponseByte: func() { t.at(func(now time.Time) { t.firstByte = now }) },
+	})
+}
+
+// request -- the raw HTTP request with the trace attached
+func (t *requestTrace) request(req *http.Request) *http.Request {
+	if t == nil {
+		return req
+	}
+	return req.WithContext(t.context())
+}
+
+// done -- record the phases once the response body has been read
+func (t *requestTrace) done() {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	s := t.stats
+	atomic.AddInt32(&s.requests, 1)
+	if t.reused {
+		atomic.AddInt32(&s.reused, 1)
+	}
+	if t.dialed {
+		atomic.AddInt32(&s.dials, 1)
+		s.dns.record(t.dns)
+		s.connect.record(t.connect)
+		s.tls.record(t.tls)
+	}
+	if !t.gotConn.IsZero() && !t.wrote.IsZero() {
+		s.write.record(t.wrote.Sub(t.gotConn))
+	}
+	if !t.wrote.IsZero() && !t.firstByte.IsZero() {
+		s.ttfb.record(t.firstByte.Sub(t.wrote))
+		s.transfer.record(now.Sub(t.firstByte))
+	}
+}
+
+// reportTraces -- log the phase breakdown of each operation since the last report and reset them
+func reportTraces(label string) {
+	if !traceRequests {
+		return
+	}
+	breakdown := func(h *latencyHistogram) string {
+		return fmt.Sprintf("%s/%s", h.mean(), h.percentile(99))
+	}
+	for _, op := range traceOps {
+		s := traces[op]
+		requests := atomic.LoadInt32(&s.requests)
+		if requests == 0 {
+			continue
+		}
+		logit(fmt.Sprintf("%s trace %s: requests = %d, reused = %.1f%%, new connections = %d, avg/p99 dns = %s, connect = %s, tls = %s, write = %s, ttfb = %s, transfer = %s",
+			label, op, requests, 100*float64(atomic.LoadInt32(&s.reused))/float64(requests), atomic.LoadInt32(&s.dials),
+			breakdown(&s.dns), breakdown(&s.connect), breakdown(&s.tls), breakdown(&s.write), breakdown(&s.ttfb), breakdown(&s.transfer)))
+		atomic.StoreInt32(&s.requests, 0)
+		atomic.StoreInt32(&s.reused, 0)
+		atomic.StoreInt32(&s.dials, 0)
+		for _, h := range []*latencyHistogram{&s.dns, &s.connect, &s.tls, &s.write, &s.ttfb, &s.transfer} {
+			h.reset()
+		}
+	}
+}
+
+// reportPhase -- the per endpoint, per request phase and TLS handshake reports after a test phase
+func reportPhase(label string) {
+	balancer.report(label)
+	reportTraces(label)
+	reportTLS(label)
+	monitor.report(label)
+}
+
+var tlsVersions = map[string]uint16{"1.0": tls.VersionTLS10, "1.1": tls.VersionTLS11, "1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13}
+
+// newTLSConfig -- client TLS settings from the -tls flags
+func newTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: !tlsVerify && tlsCA == ""}
+	if tlsCA != "" {
+		pem, err := ioutil.ReadFile(tlsCA)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates in %s", tlsCA)
+		}
+	}
+	if tlsCert != "" || tlsKey != "" {
+		cert, err := tls.LoadX509KeyPair(tlsCert, tlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if tlsMinVersion != "" {
+		version, ok := tlsVersions[tlsMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown minimum version %q, expecting 1.0, 1.1, 1.2 or 1.3", tlsMinVersion)
+		}
+		config.MinVersion = version
+	}
+	if tlsCiphers != "" {
+		suites := map[string]uint16{}
+		for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			suites[suite.Name] = suite.ID
+		}
+		for _, name := range strings.Split(tlsCiphers, ",") {
+			id, ok := suites[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown cipher suite %q", name)
+			}
+			config.CipherSuites = append(config.CipherSuites, id)
+		}
+	}
+	// Without a session cache every new connection does a full handshake
+	if tlsTickets {
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	} else {
+		config.SessionTicketsDisabled = true
+	}
+	return config, nil
+}
+
+// tlsDialer -- TLS over dial with every handshake counted and timed, httptrace still sees the handshake
+func tlsDialer(config *tls.Config, dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		raw, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		connConfig := config.Clone()
+		if connConfig.ServerName == "" {
+			connConfig.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		conn := tls.Client(raw, connConfig)
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		trace := httptrace.ContextClientTrace(ctx)
+		if trace != nil && trace.TLSHandshakeStart != nil {
+			trace.TLSHandshakeStart()
+		}
+		start := time.Now()
+		err = conn.HandshakeContext(ctx)
+		tlsLatency.record(time.Since(start))
+		atomic.AddInt32(&tlsHandshakes, 1)
+		state := conn.ConnectionState()
+		if trace != nil && trace.TLSHandshakeDone != nil {
+			trace.TLSHandshakeDone(state, err)
+		}
+		if err != nil {
+			atomic.AddInt32(&tlsErrors, 1)
+			raw.Close()
+			return nil, err
+		}
+		if state.DidResume {
+			atomic.AddInt32(&tlsResumed, 1)
+		}
+		return conn, nil
+	}
+}
+
+// reportTLS -- log the handshakes since the last report and reset them
+func reportTLS(label string) {
+	handshakes := atomic.SwapInt32(&tlsHandshakes, 0)
+	if handshakes == 0 {
+		return
+	}
+	logit(fmt.Sprintf("%s TLS: handshakes = %d, resumed = %d, errors = %d, latency avg = %s, p99 = %s, total = %.3f secs",
+		label, handshakes, atomic.SwapInt32(&tlsResumed, 0), atomic.SwapInt32(&tlsErrors, 0),
+		tlsLatency.mean(), tlsLatency.percentile(99), (tlsLatency.mean() * time.Duration(handshakes)).Seconds()))
+	tlsLatency.reset()
+}
+
+// clientSample -- the counters of the benchmark process and the network interfaces at one point in time
+type clientSample struct {
+	at             time.Time
+	cpu            time.Duration
+	gcCPU          time.Duration
+	numGC          uint32
+	gcPause        uint64
+	alloc, mallocs uint64
+	heap           uint64
+	goroutines     int
+	rx, tx         map[string]uint64
+}
+
+// clientMonitor -- samples the resources of the client every second to tell a slow server from a saturated client
+type clientMonitor struct {
+	mu             sync.Mutex
+	start, last    clientSample
+	peakCPU        float64
+	peakHeap       uint64
+	peakGoroutines int
+	peakRx, peakTx map[string]float64
+}
+
+var processStart = time.Now()
+
+// userHZ -- clock ticks per second of the /proc/self/stat CPU times
+const userHZ = 100
+
+func takeClientSample() clientSample {
+	s := clientSample{at: time.Now(), goroutines: runtime.NumGoroutine(), rx: map[string]uint64{}, tx: map[string]uint64{}}
+	// utime and stime are the 14th and 15th fields, the 2nd field is the command in parentheses
+	if stat, err := ioutil.ReadFile("/proc/self/stat"); err == nil {
+		if i := bytes.LastIndexByte(stat, ')'); i >= 0 {
+			fields := strings.Fields(string(stat[i+1:]))
+			if len(fields) > 12 {
+				utime, _ := strconv.ParseUint(fields[11], 10, 64)
+				stime, _ := strconv.ParseUint(fields[12], 10, 64)
+				s.cpu = time.Duration(utime+stime) * time.Second / userHZ
+			}
+		}
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	// GCCPUFraction is the share of all available CPU since the start of the process
+	s.gcCPU = time.Duration(mem.GCCPUFraction * float64(runtime.GOMAXPROCS(0)) * float64(s.at.Sub(processStart)))
+	s.numGC, s.gcPause = mem.NumGC, mem.PauseTotalNs
+	s.alloc, s.mallocs, s.heap = mem.TotalAlloc, mem.Mallocs, mem.HeapAlloc
+	// Receive bytes are the 1st and transmit bytes the 9th value after the interface name
+	if dev, err := ioutil.ReadFile("/proc/net/dev"); err == nil {
+		for _, line := range strings.Split(string(dev), "\n") {
+			i := strings.IndexByte(line, ':')
+			if i < 0 {
+				continue
+			}
+			fields := strings.Fields(line[i+1:])
+			if len(fields) < 9 {
+				continue
+			}
+			name := strings.TrimSpace(line[:i])
+			s.rx[name], _ = strconv.ParseUint(fields[0], 10, 64)
+			s.tx[name], _ = strconv.ParseUint(fields[8], 10, 64)
+		}
+	}
+	return s
+}
+
+func startClientMonitor() *clientMonitor {
+	m := &clientMonitor{}
+	m.reset(takeClientSample())
+	go func() {
+		for range time.Tick(time.Second) {
+			m.sample()
+		}
+	}()
+	return m
+}
+
+func (m *clientMonitor) reset(s clientSample) {
+	m.start, m.last = s, s
+	m.peakCPU, m.peakHeap, m.peakGoroutines = 0, s.heap, s.goroutines
+	m.peakRx, m.peakTx = map[string]float64{}, map[string]float64{}
+}
+
+// sample -- peaks of the second since the previous sample
+func (m *clientMonitor) sample() {
+	s := takeClientSample()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	secs := s.at.Sub(m.last.at).Seconds()
+	if secs <= 0 {
+		return
+	}
+	if cores := (s.cpu - m.last.cpu).Seconds() / secs; cores > m.peakCPU {
+		m.peakCPU = cores
+	}
+	if s.heap > m.peakHeap {
+		m.peakHeap = s.heap
+	}
+	if s.goroutines > m.peakGoroutines {
+		m.peakGoroutines = s.goroutines
+	}
+	for name := range s.rx {
+		if rate := float64(s.rx[name]-m.last.rx[name]) / secs; rate > m.peakRx[name] {
+			m.peakRx[name] = rate
+		}
+		if rate := float64(s.tx[name]-m.last.tx[name]) / secs; rate > m.peakTx[name] {
+			m.peakTx[name] = rate
+		}
+	}
+	m.last = s
+}
+
+// linkSpeed -- bytes/sec of a network interface, 0 when unknown like for loopback and most virtual interfaces
+func linkSpeed(name string) float64 {
+	speed, err := ioutil.ReadFile("/sys/class/net/" + name + "/speed")
+	if err != nil {
+		return 0
+	}
+	mbits, err := strconv.ParseFloat(strings.TrimSpace(string(speed)), 64)
+	if err != nil || mbits <= 0 {
+		return 0
+	}
+	return mbits * 1e6 / 8
 }
 
-var httpClient = &http.Client{Transport: HTTPTransport}
+// report -- log the client resources since the last report with a warning when the client looks saturated, and start over
+func (m *clientMonitor) report(label string) {
+	if m == nil {
+		return
+	}
+	m.sample()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	start, end := m.start, m.last
+	secs := end.at.Sub(start.at).Seconds()
+	if secs <= 0 {
+		return
+	}
+	procs := runtime.GOMAXPROCS(0)
+	cpu := (end.cpu - start.cpu).Seconds()
+	gcCPU := (end.gcCPU - start.gcCPU).Seconds()
+	gcShare := 0.0
+	if cpu > 0 {
+		gcShare = 100 * gcCPU / cpu
+	}
+	logit(fmt.Sprintf("%s client: cpu = %.2f cores avg, %.2f peak of %d, gc = %d cycles, pause = %s, gc cpu = %.1f%%, alloc = %sB/sec, %.0f objects/sec, heap peak = %sB, goroutines peak = %d",
+		label, cpu/secs, m.peakCPU, procs, end.numGC-start.numGC, time.Duration(end.gcPause-start.gcPause), gcShare,
+		byteRate(float64(end.alloc-start.alloc)/secs), float64(end.mallocs-start.mallocs)/secs, byteRate(float64(m.peakHeap)), m.peakGoroutines))
+	names := []string{}
+	for name := range end.rx {
+		if end.rx[name] != start.rx[name] || end.tx[name] != start.tx[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var warnings []string
+	for _, name := range names {
+		logit(fmt.Sprintf("%s client net %s: rx = %sB/sec, %sB/sec peak, tx = %sB/sec, %sB/sec peak",
+			label, name, byteRate(float64(end.rx[name]-start.rx[name])/secs), byteRate(m.peakRx[name]),
+			byteRate(float64(end.tx[name]-start.tx[name])/secs), byteRate(m.peakTx[name])))
+		if speed := linkSpeed(name); speed > 0 && math.Max(m.peakRx[name], m.peakTx[name]) >= 0.9*speed {
+			warnings = append(warnings, fmt.Sprintf("%s at %.0f%% of its %sB/sec link", name, 100*math.Max(m.peakRx[name], m.peakTx[name])/speed, byteRate(speed)))
+		}
+	}
+	if cpu/secs >= 0.9*float64(procs) {
+		warnings = append(warnings, fmt.Sprintf("CPU bound at %.2f of %d cores", cpu/secs, procs))
+	}
+	if gcShare >= 25 {
+		warnings = append(warnings, fmt.Sprintf("%.0f%% of the CPU spent in GC", gcShare))
+	}
+	if len(warnings) > 0 {
+		logit(fmt.Sprintf("%s client WARNING: the client looks saturated, %s, the results may be limited by the client and not the server",
+			label, strings.Join(warnings, ", ")))
+	}
+	m.reset(end)
+}
 
 func getS3Client() *s3.S3 {
+	return newS3Client(httpClient)
+}
+
+// getThreadS3Client -- client over the connection pool of the thread
+func getThreadS3Client(thread_num int) *s3.S3 {
+	return newS3Client(threadHTTPClient(thread_num))
+}
+
+func newS3Client(httpClient *http.Client) *s3.S3 {
 	// Build our config
 	creds := credentials.NewStaticCredentials(accessKey, secretKey, "")
 	loglevel := aws.LogOff
@@ -92,7 +884,7 @@ func getS3Client() *s3.S3 {
 		S3ForcePathStyle:     aws.Bool(true),
 		S3Disable100Continue: aws.Bool(true),
 		// Comment following to use default transport
-		HTTPClient: &http.Client{Transport: HTTPTransport},
+		HTTPClient: httpClient,
 	}
 	session := session.New(awsConfig)
 	client := s3.New(session)
@@ -103,7 +895,7 @@ func getS3Client() *s3.S3 {
 	return client
 }
 
-func createBucket(ignore_errors bool) {
+func createBucket(bucket string, ignore_errors bool) {
 	// Get a client
 	client := getS3Client()
 	// Create our bucket (may already exist without error)
@@ -117,9 +909,12 @@ func createBucket(ignore_errors bool) {
 	}
 }
 
-func deleteAllObjects() {
-	// Get a client
-	client := getS3Client()
+func deleteAllObjects(client *s3.S3, bucket string) {
+	deleteObjects(client, bucket, "", "")
+}
+
+// deleteObjects -- delete the objects and versions under prefix with keys ending in suffix, "" for all of them
+func deleteObjects(client *s3.S3, bucket, prefix, suffix string) {
 	// Use multiple routines to do the actual delete
 	var doneDeletes sync.WaitGroup
 	// Loop deleting our versions reading as big a list as we can
@@ -128,13 +923,20 @@ func deleteAllObjects() {
 	for loop := 1; ; loop++ {
 		// Delete all the existing objects and versions in the bucket
 		in := &s3.ListObjectVersionsInput{Bucket: aws.String(bucket), KeyMarker: keyMarker, VersionIdMarker: versionId, MaxKeys: aws.Int64(1000)}
+		if prefix != "" {
+			in.Prefix = aws.String(prefix)
+		}
 		if listVersions, listErr := client.ListObjectVersions(in); listErr == nil {
 			delete := &s3.Delete{Quiet: aws.Bool(true)}
 			for _, version := range listVersions.Versions {
-				delete.Objects = append(delete.Objects, &s3.ObjectIdentifier{Key: version.Key, VersionId: version.VersionId})
+				if strings.HasSuffix(*version.Key, suffix) {
+					delete.Objects = append(delete.Objects, &s3.ObjectIdentifier{Key: version.Key, VersionId: version.VersionId})
+				}
 			}
 			for _, marker := range listVersions.DeleteMarkers {
-				delete.Objects = append(delete.Objects, &s3.ObjectIdentifier{Key: marker.Key, VersionId: marker.VersionId})
+				if strings.HasSuffix(*marker.Key, suffix) {
+					delete.Objects = append(delete.Objects, &s3.ObjectIdentifier{Key: marker.Key, VersionId: marker.VersionId})
+				}
 			}
 			if len(delete.Objects) > 0 {
 				// Start a delete routine
@@ -214,172 +1016,2506 @@ func setSignature(req *http.Request) {
 	req.Header.Set("Authorization", fmt.Sprintf("AWS %s:%s", accessKey, signature))
 }
 
-func runUpload(thread_num int) {
-	for time.Now().Before(endTime) {
-		objnum := atomic.AddInt32(&uploadCount, 1)
-		fileobj := bytes.NewReader(objectData)
-		prefix := fmt.Sprintf("%s/%s/Object-%d", urlHost, bucket, objnum)
-		req, _ := http.NewRequest("PUT", prefix, fileobj)
-		req.Header.Set("Content-Length", strconv.FormatUint(objectSize, 10))
-		req.Header.Set("Content-MD5", objectDataMd5)
-		setSignature(req)
-		if resp, err := httpClient.Do(req); err != nil {
-			log.Fatalf("FATAL: Error uploading object %s: %v", prefix, err)
-		} else if resp != nil && resp.StatusCode != http.StatusOK {
-			if resp.StatusCode == http.StatusServiceUnavailable {
-				atomic.AddInt32(&uploadSlowdownCount, 1)
-				atomic.AddInt32(&uploadCount, -1)
-			} else {
-				fmt.Printf("Upload status %s: resp: %+v\n", resp.Status, resp)
-				if resp.Body != nil {
-					body, _ := ioutil.ReadAll(resp.Body)
-					fmt.Printf("Body: %s\n", string(body))
+// Number of latency histogram buckets: 16 linear ones below 16us, then 8 per power of two
+const latencyBuckets = 16 + 60*8
+
+// latencyHistogram -- lock free log-linear histogram of request latencies in microseconds
+type latencyHistogram struct {
+	count   int64
+	sumNs   int64
+	buckets [latencyBuckets]int64
+}
+
+func latencyBucket(us uint64) int {
+	if us < 16 {
+		return int(us)
+	}
+	e := bits.Len64(us)
+	n := 16 + (e-5)*8 + int((us>>uint(e-4))&7)
+	if n >= latencyBuckets {
+		n = latencyBuckets - 1
+	}
+	return n
+}
+
+// latencyBucketValue -- middle of the range covered by bucket n, in microseconds
+func latencyBucketValue(n int) uint64 {
+	if n < 16 {
+		return uint64(n)
+	}
+	e := uint((n-16)/8 + 5)
+	m := uint64((n - 16) % 8)
+	lower := (8 + m) << (e - 4)
+	upper := (9 + m) << (e - 4)
+	return (lower + upper) / 2
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	atomic.AddInt64(&h.count, 1)
+	atomic.AddInt64(&h.sumNs, int64(d))
+	atomic.AddInt64(&h.buckets[latencyBucket(uint64(d/time.Microsecond))], 1)
+}
+
+func (h *latencyHistogram) reset() {
+	atomic.StoreInt64(&h.count, 0)
+	atomic.StoreInt64(&h.sumNs, 0)
+	for n := range h.buckets {
+		atomic.StoreInt64(&h.buckets[n], 0)
+	}
+}
+
+// latencySnapshot -- a latencyHistogram as JSON, without the empty buckets at the end
+type latencySnapshot struct {
+	Count, SumNs int64
+	Buckets      []int64
+}
+
+func (h *latencyHistogram) snapshot() latencySnapshot {
+	s := latencySnapshot{Count: atomic.LoadInt64(&h.count), SumNs: atomic.LoadInt64(&h.sumNs)}
+	for n := range h.buckets {
+		if count := atomic.LoadInt64(&h.buckets[n]); count > 0 {
+			for len(s.Buckets) < n {
+				s.Buckets = append(s.Buckets, 0)
+			}
+			s.Buckets = append(s.Buckets, count)
+		}
+	}
+	return s
+}
+
+// merge -- add the requests of another histogram, eg. from an agent
+func (h *latencyHistogram) merge(s latencySnapshot) {
+	atomic.AddInt64(&h.count, s.Count)
+	atomic.AddInt64(&h.sumNs, s.SumNs)
+	for n, count := range s.Buckets {
+		if n < latencyBuckets {
+			atomic.AddInt64(&h.buckets[n], count)
+		}
+	}
+}
+
+func (h *latencyHistogram) mean() time.Duration {
+	count := atomic.LoadInt64(&h.count)
+	if count == 0 {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&h.sumNs) / count)
+}
+
+// percentile -- approximate latency below which p (0..100) percent of the requests completed
+func (h *latencyHistogram) percentile(p float64) time.Duration {
+	count := atomic.LoadInt64(&h.count)
+	if count == 0 {
+		return 0
+	}
+	rank := int64(float64(count)*p/100 + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for n := range h.buckets {
+		seen += atomic.LoadInt64(&h.buckets[n])
+		if seen >= rank {
+			return time.Duration(latencyBucketValue(n)) * time.Microsecond
+		}
+	}
+	return time.Duration(latencyBucketValue(latencyBuckets-1)) * time.Microsecond
+}
+
+// pacer -- spreads operations of all threads evenly to reach a target rate
+type pacer struct {
+	interval int64
+	next     int64
+}
+
+func newPacer(opsPerSec int) *pacer {
+	if opsPerSec <= 0 {
+		return nil
+	}
+	return &pacer{interval: int64(time.Second) / int64(opsPerSec)}
+}
+
+// wait -- block until the next free slot, false if that slot is past the deadline
+func (p *pacer) wait(deadline time.Time) bool {
+	if p == nil {
+		return true
+	}
+	for {
+		next := atomic.LoadInt64(&p.next)
+		slot := next
+		// Do not let idle time pile up into a burst
+		if now := time.Now().UnixNano(); slot < now {
+			slot = now
+		}
+		if atomic.CompareAndSwapInt64(&p.next, next, slot+p.interval) {
+			at := time.Unix(0, slot)
+			if at.After(deadline) {
+				return false
+			}
+			time.Sleep(time.Until(at))
+			return true
+		}
+	}
+}
+
+// throttle -- token bucket limiting the bytes per second of everyone sharing it
+type throttle struct {
+	rate  int64
+	burst int64
+	next  int64
+}
+
+func newThrottle(bytesPerSec uint64) *throttle {
+	if bytesPerSec == 0 {
+		return nil
+	}
+	// Allow 100ms worth of bytes ahead so small reads do not sleep one by one
+	return &throttle{rate: int64(bytesPerSec), burst: int64(100 * time.Millisecond)}
+}
+
+// chunk -- largest read to take at once, about 1/20 of a second at the limit
+func (t *throttle) chunk() int {
+	if size := t.rate / 20; size < 64*1024 {
+		if size < 512 {
+			return 512
+		}
+		return int(size)
+	}
+	return 64 * 1024
+}
+
+// take -- block until n more bytes fit into the limit
+func (t *throttle) take(n int) {
+	if t == nil || n <= 0 {
+		return
+	}
+	cost := int64(n) * int64(time.Second) / t.rate
+	for {
+		next := atomic.LoadInt64(&t.next)
+		slot := next
+		// Do not let idle time pile up into a burst
+		now := time.Now().UnixNano()
+		if slot < now {
+			slot = now
+		}
+		if atomic.CompareAndSwapInt64(&t.next, next, slot+cost) {
+			if wait := slot + cost - now; wait > t.burst {
+				time.Sleep(time.Duration(wait - t.burst))
+			}
+			return
+		}
+	}
+}
+
+// throttledReader -- reads through a per thread and a global throttle
+type throttledReader struct {
+	r              io.Reader
+	thread, global *throttle
+}
+
+func throttleReader(r io.Reader, thread, global *throttle) io.Reader {
+	if thread == nil && global == nil {
+		return r
+	}
+	return &throttledReader{r: r, thread: thread, global: global}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	for _, limit := range []*throttle{t.thread, t.global} {
+		if limit != nil && len(p) > limit.chunk() {
+			p = p[:limit.chunk()]
+		}
+	}
+	n, err := t.r.Read(p)
+	t.thread.take(n)
+	t.global.take(n)
+	return n, err
+}
+
+// threadThrottles -- upload and download throttles of one thread, nil without limits
+func threadThrottles(thread_num int) (upload, download *throttle) {
+	if threadUploadRate == 0 && threadDownloadRate == 0 {
+		return nil, nil
+	}
+	threadThrottlesMu.Lock()
+	defer threadThrottlesMu.Unlock()
+	limits, ok := threadLimits[thread_num]
+	if !ok {
+		limits = [2]*throttle{newThrottle(threadUploadRate), newThrottle(threadDownloadRate)}
+		threadLimits[thread_num] = limits
+	}
+	return limits[0], limits[1]
+}
+
+// keyPart -- appends one piece of an object key for the given object number
+type keyPart func(b *strings.Builder, objnum int32)
+
+// keyNamer -- builds object keys from object numbers so every phase can find the same objects again
+type keyNamer struct {
+	scheme string
+	parts  []keyPart
+	suffix string
+}
+
+// Key templates of the built-in naming schemes, see compileKeyTemplate for the placeholders
+var keySchemes = map[string]string{
+	"sequential": "Object-{n}",
+	"random":     "{hex}-Object-{n}",
+	"hashed":     "{hash}/Object-{n}",
+	"reversed":   "Object-{rev}",
+	"date":       "{date}/Object-{n}",
+	"tree":       "{tree}/Object-{n}",
+}
+
+func newKeyNamer(scheme, template string) (keyNamer, error) {
+	if scheme != "template" {
+		var ok bool
+		if template, ok = keySchemes[scheme]; !ok {
+			return keyNamer{}, fmt.Errorf("unknown key scheme %q, expecting sequential, random, hashed, reversed, date, tree or template", scheme)
+		}
+	}
+	parts, err := compileKeyTemplate(template)
+	return keyNamer{scheme: scheme, parts: parts}, err
+}
+
+func (k keyNamer) key(objnum int32) string {
+	var b strings.Builder
+	for _, part := range k.parts {
+		part(&b, objnum)
+	}
+	b.WriteString(k.suffix)
+	return b.String()
+}
+
+// mix64 -- murmur3 finalizer, spreads consecutive object numbers over the whole 64 bit range
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// compileKeyTemplate -- turn a key template into key parts, placeholders are:
+//
+//	{n} or {n:WIDTH}   object number, optionally zero padded
+//	{rev}              object number zero padded to 10 digits and reversed
+//	{hex} or {hex:N}   N random hex digits, stable for the run (default -key-prefix)
+//	{hash} or {hash:N} first N hex digits of the md5 of the object number (default -key-prefix)
+//	{date} or {date:LAYOUT} time of the object, -key-date-step apart, in Go layout (default 2006/01/02/15)
+//	{tree}             -key-levels directories with -key-fanout entries each
+func compileKeyTemplate(template string) ([]keyPart, error) {
+	var parts []keyPart
+	salt, epoch := keySalt, keyEpoch
+	for len(template) > 0 {
+		open := strings.IndexByte(template, '{')
+		if open < 0 {
+			open = len(template)
+		}
+		if open > 0 {
+			literal := template[:open]
+			parts = append(parts, func(b *strings.Builder, objnum int32) { b.WriteString(literal) })
+			template = template[open:]
+			continue
+		}
+		end := strings.IndexByte(template, '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated placeholder in key template at %q", template)
+		}
+		name, arg := template[1:end], ""
+		if colon := strings.IndexByte(name, ':'); colon >= 0 {
+			name, arg = name[:colon], name[colon+1:]
+		}
+		template = template[end+1:]
+
+		width := keyPrefixLen
+		if arg != "" && name != "date" {
+			var err error
+			if width, err = strconv.Atoi(arg); err != nil || width < 1 {
+				return nil, fmt.Errorf("invalid width %q for {%s} in key template", arg, name)
+			}
+		}
+		switch name {
+		case "n":
+			format := "%d"
+			if arg != "" {
+				format = "%0" + arg + "d"
+			}
+			parts = append(parts, func(b *strings.Builder, objnum int32) { fmt.Fprintf(b, format, objnum) })
+		case "rev":
+			parts = append(parts, func(b *strings.Builder, objnum int32) {
+				digits := []byte(fmt.Sprintf("%010d", objnum))
+				for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+					digits[i], digits[j] = digits[j], digits[i]
+				}
+				b.Write(digits)
+			})
+		case "hex":
+			parts = append(parts, func(b *strings.Builder, objnum int32) {
+				b.WriteString(hexDigits(mix64(uint64(objnum)^salt), width))
+			})
+		case "hash":
+			parts = append(parts, func(b *strings.Builder, objnum int32) {
+				sum := md5.Sum([]byte(strconv.Itoa(int(objnum))))
+				b.WriteString(hexDigits(binary.BigEndian.Uint64(sum[:8]), width))
+			})
+		case "date":
+			layout := arg
+			if layout == "" {
+				layout = "2006/01/02/15"
+			}
+			parts = append(parts, func(b *strings.Builder, objnum int32) {
+				b.WriteString(epoch.Add(time.Duration(objnum) * keyDateStep).Format(layout))
+			})
+		case "tree":
+			if keyLevels < 1 || keyFanout < 1 {
+				return nil, fmt.Errorf("{tree} needs -key-levels and -key-fanout of at least 1")
+			}
+			parts = append(parts, func(b *strings.Builder, objnum int32) {
+				// Lowest digit first, so consecutive objects land in different top level directories
+				n := int(objnum)
+				for level := 0; level < keyLevels; level++ {
+					if level > 0 {
+						b.WriteByte('/')
+					}
+					fmt.Fprintf(b, "d%d", n%keyFanout)
+					n /= keyFanout
+				}
+			})
+		default:
+			return nil, fmt.Errorf("unknown placeholder {%s} in key template", name)
+		}
+	}
+	return parts, nil
+}
+
+// hexDigits -- the first n hex digits of v, repeating v when more than 16 are needed
+func hexDigits(v uint64, n int) string {
+	digits := fmt.Sprintf("%016x", v)
+	for len(digits) < n {
+		digits += fmt.Sprintf("%016x", mix64(v+uint64(len(digits))))
+	}
+	return digits[:n]
+}
+
+func objectUrl(objnum int32) string {
+	return fmt.Sprintf("%s/%s/%s", urlHost, bucket, objectKey.key(objnum))
+}
+
+// listPrefix -- a prefix shared by the object and some of its neighbours, used by the listing tests
+func listPrefix(objnum int32) string {
+	if objectKey.scheme == "sequential" {
+		return fmt.Sprintf(`Object-%d`, objnum%100)
+	}
+	key := objectKey.key(objnum)
+	if slash := strings.LastIndexByte(key, '/'); slash >= 0 {
+		return key[:slash+1]
+	}
+	return key[:len(key)*2/3]
+}
+
+// keyPicker -- chooses which of the n uploaded objects (1..n) the next read touches
+type keyPicker interface {
+	pick(n int32) int32
+}
+
+func newKeyPicker(name string, skew float64, hotspot string) (keyPicker, error) {
+	switch name {
+	case "uniform":
+		return uniformPicker{}, nil
+	case "sequential":
+		return &sequentialPicker{}, nil
+	case "zipf", "latest":
+		if skew <= 0 || skew >= 1 {
+			return nil, fmt.Errorf("zipf skew must be between 0 and 1, got %v", skew)
+		}
+		if name == "latest" {
+			return latestPicker{&zipfPicker{theta: skew}}, nil
+		}
+		return &zipfPicker{theta: skew}, nil
+	case "hotspot":
+		parts := strings.Split(hotspot, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("hotspot must be KEYS%%:OPS%%, got %q", hotspot)
+		}
+		keys, err1 := strconv.ParseFloat(parts[0], 64)
+		ops, err2 := strconv.ParseFloat(parts[1], 64)
+		if err1 != nil || err2 != nil || keys <= 0 || keys > 100 || ops < 0 || ops > 100 {
+			return nil, fmt.Errorf("hotspot percentages must be between 0 and 100, got %q", hotspot)
+		}
+		return hotspotPicker{hotKeys: keys / 100, hotOps: ops / 100}, nil
+	}
+	return nil, fmt.Errorf("unknown key distribution %q, expecting uniform, zipf, hotspot, sequential or latest", name)
+}
+
+type uniformPicker struct{}
+
+func (uniformPicker) pick(n int32) int32 {
+	if n < 1 {
+		return 1
+	}
+	return rand.Int31n(n) + 1
+}
+
+// sequentialPicker -- walks all objects in order, shared by all threads
+type sequentialPicker struct {
+	next int32
+}
+
+func (p *sequentialPicker) pick(n int32) int32 {
+	if n < 1 {
+		return 1
+	}
+	v := atomic.AddInt32(&p.next, 1)
+	if v < 1 {
+		atomic.StoreInt32(&p.next, 0)
+		v = 1
+	}
+	return (v-1)%n + 1
+}
+
+// hotspotPicker -- hotKeys fraction of the objects receive hotOps fraction of the reads
+type hotspotPicker struct {
+	hotKeys, hotOps float64
+}
+
+func (p hotspotPicker) pick(n int32) int32 {
+	if n < 1 {
+		return 1
+	}
+	hot := int32(float64(n) * p.hotKeys)
+	if hot < 1 {
+		hot = 1
+	}
+	if hot >= n || rand.Float64() < p.hotOps {
+		return rand.Int31n(hot) + 1
+	}
+	return hot + rand.Int31n(n-hot) + 1
+}
+
+// zipfPicker -- zipfian distribution as in YCSB (Gray et al.), object 1 is the hottest
+type zipfPicker struct {
+	theta float64
+	mu    sync.Mutex
+	n     int32
+	zetan float64
+	zeta2 float64
+	alpha float64
+	eta   float64
+}
+
+func (p *zipfPicker) pick(n int32) int32 {
+	if n < 1 {
+		return 1
+	}
+	p.mu.Lock()
+	if n != p.n {
+		// The keyspace only grows, so extend the zeta sum instead of recomputing it
+		if n < p.n {
+			p.n, p.zetan = 0, 0
+		}
+		for i := p.n + 1; i <= n; i++ {
+			p.zetan += 1 / math.Pow(float64(i), p.theta)
+		}
+		p.n = n
+		p.zeta2 = 1 + 1/math.Pow(2, p.theta)
+		p.alpha = 1 / (1 - p.theta)
+		p.eta = (1 - math.Pow(2/float64(n), 1-p.theta)) / (1 - p.zeta2/p.zetan)
+	}
+	zetan, alpha, eta := p.zetan, p.alpha, p.eta
+	p.mu.Unlock()
+
+	u := rand.Float64()
+	uz := u * zetan
+	if uz < 1 {
+		return 1
+	}
+	if uz < 1+math.Pow(0.5, p.theta) && n >= 2 {
+		return 2
+	}
+	v := 1 + int32(float64(n)*math.Pow(eta*u-eta+1, alpha))
+	if v > n {
+		v = n
+	}
+	return v
+}
+
+// latestPicker -- zipfian distribution where the most recently written object is the hottest
+type latestPicker struct {
+	zipf *zipfPicker
+}
+
+func (p latestPicker) pick(n int32) int32 {
+	if n < 1 {
+		return 1
+	}
+	return n - p.zipf.pick(n) + 1
+}
+
+func runUpload(thread_num int) {
+	for time.Now().Before(endTime) {
+		if !opPacer.wait(endTime) {
+			break
+		}
+		objnum := atomic.AddInt32(&uploadCount, 1)
+		threadLimit, _ := threadThrottles(thread_num)
+		fileobj := throttleReader(bytes.NewReader(objectData), threadLimit, uploadLimit)
+		prefix := objectUrl(objnum)
+		req, _ := http.NewRequest("PUT", prefix, fileobj)
+		req.ContentLength = int64(objectSize)
+		req.Header.Set("Content-Length", strconv.FormatUint(objectSize, 10))
+		req.Header.Set("Content-MD5", objectDataMd5)
+		setSignature(req)
+		trace := newTrace("PUT")
+		start := time.Now()
+		if resp, err := threadHTTPClient(thread_num).Do(trace.request(req)); err != nil {
+			log.Fatalf("FATAL: Error uploading object %s: %v", prefix, err)
+		} else if resp != nil && resp.StatusCode == http.StatusOK {
+			uploadLatency.record(time.Since(start))
+			trace.done()
+		} else if resp != nil {
+			if resp.StatusCode == http.StatusServiceUnavailable {
+				atomic.AddInt32(&uploadSlowdownCount, 1)
+				atomic.AddInt32(&uploadCount, -1)
+			} else {
+				fmt.Printf("Upload status %s: resp: %+v\n", resp.Status, resp)
+				if resp.Body != nil {
+					body, _ := ioutil.ReadAll(resp.Body)
+					fmt.Printf("Body: %s\n", string(body))
+				}
+			}
+		}
+	}
+	// Remember last done time
+	uploadFinish = time.Now()
+	// One less thread
+	atomic.AddInt32(&runningThreads, -1)
+}
+
+func runDownload(thread_num int) {
+	for time.Now().Before(endTime) {
+		if !opPacer.wait(endTime) {
+			break
+		}
+		atomic.AddInt32(&downloadCount, 1)
+		objnum := getPicker.pick(atomic.LoadInt32(&uploadCount))
+		prefix := objectUrl(objnum)
+		req, _ := http.NewRequest("GET", prefix, nil)
+		setSignature(req)
+		trace := newTrace("GET")
+		start := time.Now()
+		if resp, err := threadHTTPClient(thread_num).Do(trace.request(req)); err != nil {
+			log.Fatalf("FATAL: Error downloading object %s: %v", prefix, err)
+		} else if resp != nil && resp.Body != nil {
+			switch resp.StatusCode {
+			case http.StatusOK, http.StatusPartialContent:
+				_, threadLimit := threadThrottles(thread_num)
+				io.Copy(ioutil.Discard, throttleReader(resp.Body, threadLimit, downloadLimit))
+				downloadLatency.record(time.Since(start))
+				trace.done()
+			case http.StatusServiceUnavailable:
+				atomic.AddInt32(&downloadSlowdownCount, 1)
+				atomic.AddInt32(&downloadCount, -1)
+			default:
+				atomic.AddInt32(&downloadErrorCount, 1)
+				atomic.AddInt32(&downloadCount, -1)
+			}
+			resp.Body.Close()
+		}
+	}
+	// Remember last done time
+	downloadFinish = time.Now()
+	// One less thread
+	atomic.AddInt32(&runningThreads, -1)
+}
+
+func runHead(thread_num int) {
+	for time.Now().Before(endTime) {
+		if !opPacer.wait(endTime) {
+			break
+		}
+		atomic.AddInt32(&headCount, 1)
+		objnum := getPicker.pick(atomic.LoadInt32(&uploadCount))
+		prefix := objectUrl(objnum)
+		req, _ := http.NewRequest("HEAD", prefix, nil)
+		setSignature(req)
+		trace := newTrace("HEAD")
+		start := time.Now()
+		if resp, err := threadHTTPClient(thread_num).Do(trace.request(req)); err != nil {
+			log.Fatalf("FATAL: Error checking object %s: %v", prefix, err)
+		} else if resp != nil {
+			if resp.Body != nil {
+				resp.Body.Close()
+			}
+			switch resp.StatusCode {
+			case http.StatusOK:
+				headLatency.record(time.Since(start))
+				trace.done()
+			case http.StatusServiceUnavailable:
+				atomic.AddInt32(&headSlowdownCount, 1)
+				atomic.AddInt32(&headCount, -1)
+			default:
+				atomic.AddInt32(&headErrorCount, 1)
+				atomic.AddInt32(&headCount, -1)
+			}
+		}
+	}
+	// Remember last done time
+	headFinish = time.Now()
+	// One less thread
+	atomic.AddInt32(&runningThreads, -1)
+}
+
+// deleteCopies -- remove what the copy phase wrote so later listings only see the uploaded objects
+func deleteCopies() {
+	deleteObjects(getS3Client(), copyBucket, "copy/", objectKey.suffix)
+}
+
+// copyKey -- destination key of the server-side copy of an object
+func copyKey(objnum int32) string {
+	return "copy/" + objectKey.key(objnum)
+}
+
+// copyObject -- CopyObject in a single request, true when the server asked to slow down
+func copyObject(client *http.Client, objnum int32) (bool, error) {
+	dest := fmt.Sprintf("%s/%s/%s", urlHost, copyBucket, copyKey(objnum))
+	req, _ := http.NewRequest("PUT", dest, nil)
+	req.Header.Set("X-Amz-Copy-Source", "/"+bucket+"/"+objectKey.key(objnum))
+	setSignature(req)
+	trace := newTrace("COPY")
+	resp, err := client.Do(trace.request(req))
+	if err != nil {
+		log.Fatalf("FATAL: Error copying object %s: %v", dest, err)
+	}
+	defer resp.Body.Close()
+	// A copy can fail after the 200 status was sent, the error is then in the body
+	body, _ := ioutil.ReadAll(resp.Body)
+	trace.done()
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		return true, nil
+	}
+	if resp.StatusCode != http.StatusOK || bytes.Contains(body, []byte("<Error>")) {
+		return false, fmt.Errorf("copy %s status %s: %s", dest, resp.Status, body)
+	}
+	return false, nil
+}
+
+// copyObjectParts -- server-side copy of an object with UploadPartCopy in copyPartSize ranges
+func copyObjectParts(client *s3.S3, objnum int32) (bool, error) {
+	dest := aws.String(copyKey(objnum))
+	source := aws.String(bucket + "/" + objectKey.key(objnum))
+	trace := newTrace("COPY")
+	create, err := client.CreateMultipartUploadWithContext(trace.context(), &s3.CreateMultipartUploadInput{Bucket: aws.String(copyBucket), Key: dest})
+	trace.done()
+	if err != nil {
+		return isSlowdown(err), err
+	}
+	var parts []*s3.CompletedPart
+	for offset, part := uint64(0), int64(1); offset < objectSize; offset, part = offset+copyPartSize, part+1 {
+		last := offset + copyPartSize - 1
+		if last >= objectSize {
+			last = objectSize - 1
+		}
+		trace := newTrace("COPY")
+		res, err := client.UploadPartCopyWithContext(trace.context(), &s3.UploadPartCopyInput{
+			Bucket:          aws.String(copyBucket),
+			Key:             dest,
+			UploadId:        create.UploadId,
+			PartNumber:      aws.Int64(part),
+			CopySource:      source,
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", offset, last)),
+		})
+		trace.done()
+		if err != nil {
+			client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{Bucket: aws.String(copyBucket), Key: dest, UploadId: create.UploadId})
+			return isSlowdown(err), err
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: res.CopyPartResult.ETag, PartNumber: aws.Int64(part)})
+	}
+	trace = newTrace("COPY")
+	_, err = client.CompleteMultipartUploadWithContext(trace.context(), &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(copyBucket),
+		Key:             dest,
+		UploadId:        create.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	trace.done()
+	return isSlowdown(err), err
+}
+
+// isSlowdown -- whether an aws-sdk error is a 503 slow down response
+func isSlowdown(err error) bool {
+	reqErr, ok := err.(awserr.RequestFailure)
+	return ok && reqErr.StatusCode() == http.StatusServiceUnavailable
+}
+
+func runCopy(thread_num int) {
+	var client *s3.S3
+	if copyPartSize > 0 {
+		client = getThreadS3Client(thread_num)
+	}
+	for time.Now().Before(endTime) {
+		if !opPacer.wait(endTime) {
+			break
+		}
+		uploaded := atomic.LoadInt32(&uploadCount)
+		if uploaded < 1 {
+			break
+		}
+		// Walk the uploaded objects in order, wrapping around when all are copied
+		objnum := (atomic.AddInt32(&copyCount, 1)-1)%uploaded + 1
+		start := time.Now()
+		var slowdown bool
+		var err error
+		if client != nil {
+			slowdown, err = copyObjectParts(client, objnum)
+		} else {
+			slowdown, err = copyObject(threadHTTPClient(thread_num), objnum)
+		}
+		if slowdown {
+			atomic.AddInt32(&copySlowdownCount, 1)
+			atomic.AddInt32(&copyCount, -1)
+		} else if err != nil {
+			atomic.AddInt32(&copyErrorCount, 1)
+			atomic.AddInt32(&copyCount, -1)
+			log.Printf("WARNING: %v", err)
+		} else {
+			copyLatency.record(time.Since(start))
+		}
+	}
+	// Remember last done time
+	copyFinish = time.Now()
+	// One less thread
+	atomic.AddInt32(&runningThreads, -1)
+}
+
+// listObject -- a random uploaded object to take the listing prefix from, 1 when nothing was uploaded
+func listObject() int32 {
+	if uploaded := atomic.LoadInt32(&uploadCount); uploaded > 1 {
+		return rand.Int31n(uploaded) + 1
+	}
+	return 1
+}
+
+func runListingVersions(thread_num int) {
+	var keyMarker, versionId, delimiter *string
+	objnum := listObject()
+	prefix := listPrefix(objnum)
+	client := getThreadS3Client(thread_num)
+	delimiterCounter := 0
+	for time.Now().Before(endTime) {
+		atomic.AddInt32(&listVerCount, 1)
+		in := &s3.ListObjectVersionsInput{
+			Bucket:          aws.String(bucket),
+			KeyMarker:       keyMarker,
+			VersionIdMarker: versionId,
+			MaxKeys:         aws.Int64(1000),
+			Prefix:          &prefix,
+			Delimiter:       delimiter,
+		}
+		trace := newTrace("LISTver")
+		res, err := client.ListObjectVersionsWithContext(trace.context(), in)
+		trace.done()
+		if err != nil {
+			atomic.AddInt32(&listVerSlowdownCount, 1)
+			atomic.AddInt32(&listVerCount, -1)
+			log.Printf(`WARNING: failed %v %s`, in, err)
+		}
+		if res != nil {
+			total := uint64(len(res.Versions) + len(res.CommonPrefixes))
+			atomic.AddUint64(&listVerRowsCount, total)
+		}
+		if res == nil || len(res.Versions) == 0 || res.KeyMarker == nil || res.NextKeyMarker == nil {
+			objnum = listObject()
+			prefix = listPrefix(objnum)
+			delimiterCounter++
+			delimiterCounter %= 10
+			if delimiterCounter > 7 {
+				delimiter = nil
+			} else {
+				delimiter = aws.String(fmt.Sprint(delimiterCounter))
+			}
+		} else {
+			keyMarker = res.NextKeyMarker
+			versionId = res.NextVersionIdMarker
+		}
+	}
+	// Remember last done time
+	listVerFinish = time.Now()
+	// One less thread
+	atomic.AddInt32(&runningThreads, -1)
+}
+
+func runListObjectsV2(thread_num int) {
+	var continuationToken, delimiter *string
+	objnum := listObject()
+	prefix := listPrefix(objnum)
+	client := getThreadS3Client(thread_num)
+	delimiterCounter := 0
+	for time.Now().Before(endTime) {
+		atomic.AddInt32(&listObjCount, 1)
+		in := &s3.ListObjectsV2Input{
+			Bucket:            aws.String(bucket),
+			MaxKeys:           aws.Int64(1000),
+			Prefix:            &prefix,
+			ContinuationToken: continuationToken,
+			Delimiter:         delimiter,
+		}
+		trace := newTrace("LIST2")
+		res, err := client.ListObjectsV2WithContext(trace.context(), in)
+		trace.done()
+		if err != nil {
+			atomic.AddInt32(&listObjSlowdownCount, 1)
+			atomic.AddInt32(&listObjCount, -1)
+			log.Printf(`WARNING: failed %v %s`, in, err)
+		}
+		if res != nil {
+			total := uint64(len(res.Contents) + len(res.CommonPrefixes))
+			atomic.AddUint64(&listObjRowsCount, total)
+		}
+		if res == nil || len(res.Contents) == 0 || res.NextContinuationToken == nil {
+			objnum = listObject()
+			prefix = listPrefix(objnum)
+			delimiterCounter++
+			delimiterCounter %= 10
+			if delimiterCounter > 7 {
+				delimiter = nil
+			} else {
+				delimiter = aws.String(fmt.Sprint(delimiterCounter))
+			}
+		} else {
+			continuationToken = res.NextContinuationToken
+		}
+	}
+	// Remember last done time
+	listObjFinish = time.Now()
+	// One less thread
+	atomic.AddInt32(&runningThreads, -1)
+}
+
+func runDelete(thread_num int) {
+	for {
+		objnum := atomic.AddInt32(&deleteCount, 1)
+		if objnum > uploadCount {
+			break
+		}
+		prefix := objectUrl(objnum)
+		req, _ := http.NewRequest("DELETE", prefix, nil)
+		setSignature(req)
+		trace := newTrace("DELETE")
+		resp, err := threadHTTPClient(thread_num).Do(trace.request(req))
+		if err != nil {
+			log.Fatalf("FATAL: Error deleting object %s: %v", prefix, err)
+		} else if resp != nil && resp.StatusCode == http.StatusServiceUnavailable {
+			atomic.AddInt32(&deleteSlowdownCount, 1)
+			atomic.AddInt32(&deleteCount, -1)
+		} else if resp != nil && resp.StatusCode < http.StatusMultipleChoices {
+			trace.done()
+		}
+	}
+	// Remember last done time
+	deleteFinish = time.Now()
+	// One less thread
+	atomic.AddInt32(&runningThreads, -1)
+}
+
+// runThreads -- start n copies of runner for the given seconds and wait for all of them to stop
+func runThreads(n int, seconds int, runner func(int)) time.Duration {
+	runningThreads = int32(n)
+	startTime := time.Now()
+	endTime = startTime.Add(time.Second * time.Duration(seconds))
+	for t := 1; t <= n; t++ {
+		go runner(t)
+	}
+	for atomic.LoadInt32(&runningThreads) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	return time.Since(startTime)
+}
+
+type rampStepResult struct {
+	threads, rate  int
+	ops, slowdowns int32
+	seconds        float64
+	opsPerSec      float64
+	mean, p50, p99 time.Duration
+}
+
+// runRamp -- step the concurrency (or target rate) of one operation up and look for the saturation point
+func runRamp() {
+	var runner func(int)
+	var counter, slowdowns *int32
+	var latency *latencyHistogram
+	switch rampOp {
+	case "put":
+		runner, counter, slowdowns, latency = runUpload, &uploadCount, &uploadSlowdownCount, &uploadLatency
+	case "get":
+		// Reads need a dataset, fill the bucket the same way the PUT phase does
+		elapsed := runThreads(threads, durationSecs, runUpload)
+		logit(fmt.Sprintf("Ramp: uploaded %d objects in %.1f secs for GET", uploadCount, elapsed.Seconds()))
+		runner, counter, slowdowns, latency = runDownload, &downloadCount, &downloadSlowdownCount, &downloadLatency
+	}
+
+	var results []rampStepResult
+	for step := 0; step < rampSteps; step++ {
+		res := rampStepResult{threads: threads}
+		level := rampStart + step*rampStep
+		if rampBy == "rate" {
+			res.rate = level
+			opPacer = newPacer(level)
+		} else {
+			res.threads = level
+		}
+		ops, slows := atomic.LoadInt32(counter), atomic.LoadInt32(slowdowns)
+		latency.reset()
+		res.seconds = runThreads(res.threads, rampHoldSecs, runner).Seconds()
+		res.ops = atomic.LoadInt32(counter) - ops
+		res.slowdowns = atomic.LoadInt32(slowdowns) - slows
+		res.opsPerSec = float64(res.ops) / res.seconds
+		res.mean, res.p50, res.p99 = latency.mean(), latency.percentile(50), latency.percentile(99)
+		results = append(results, res)
+
+		bps := float64(uint64(res.ops)*objectSize) / res.seconds
+		logit(fmt.Sprintf("Ramp step %d: %s, threads = %d, rate = %d, ops = %d, speed = %sB/sec, %.1f operations/sec, latency avg = %s, p50 = %s, p99 = %s. Slowdowns = %d",
+			step+1, strings.ToUpper(rampOp), res.threads, res.rate, res.ops, byteRate(bps), res.opsPerSec,
+			res.mean, res.p50, res.p99, res.slowdowns))
+	}
+	opPacer = nil
+
+	if knee := rampKnee(results); knee > 0 {
+		best := results[knee-1]
+		logit(fmt.Sprintf("Ramp: knee at step %d, saturation around threads = %d, rate = %d with %.1f operations/sec, latency avg = %s",
+			knee+1, best.threads, best.rate, best.opsPerSec, best.mean))
+	} else {
+		best := 0
+		for n := range results {
+			if results[n].opsPerSec > results[best].opsPerSec {
+				best = n
+			}
+		}
+		logit(fmt.Sprintf("Ramp: no knee found, best throughput %.1f operations/sec at step %d, latency avg = %s",
+			results[best].opsPerSec, best+1, results[best].mean))
+	}
+}
+
+// rampKnee -- first step where throughput stops increasing while latency rises sharply, -1 if none
+func rampKnee(results []rampStepResult) int {
+	for n := 1; n < len(results); n++ {
+		prev, cur := results[n-1], results[n]
+		if prev.opsPerSec <= 0 || prev.mean <= 0 {
+			continue
+		}
+		gain := cur.opsPerSec/prev.opsPerSec - 1
+		growth := float64(cur.mean)/float64(prev.mean) - 1
+		if gain < rampThroughputGain && growth > rampLatencyGrowth {
+			return n
+		}
+	}
+	return -1
+}
+
+// Number of DeleteObjects calls per batch before its keys are counted as errors
+const multiDeleteAttempts = 10
+
+func runMultiDelete(thread_num int) {
+	client := getThreadS3Client(thread_num)
+	for {
+		// Claim the next batch of object numbers
+		last := atomic.AddInt32(&multiDeleteCount, int32(deleteBatch))
+		first := last - int32(deleteBatch) + 1
+		uploaded := atomic.LoadInt32(&uploadCount)
+		if first > uploaded {
+			break
+		}
+		if last > uploaded {
+			last = uploaded
+		}
+		del := &s3.Delete{Quiet: aws.Bool(true)}
+		for objnum := first; objnum <= last; objnum++ {
+			del.Objects = append(del.Objects, &s3.ObjectIdentifier{Key: aws.String(objectKey.key(objnum))})
+		}
+		backoff := 100 * time.Millisecond
+		for attempt := 1; ; attempt++ {
+			start := time.Now()
+			trace := newTrace("MULTIDELETE")
+			res, err := client.DeleteObjectsWithContext(trace.context(), &s3.DeleteObjectsInput{Bucket: aws.String(bucket), Delete: del})
+			trace.done()
+			if isSlowdown(err) {
+				atomic.AddInt32(&multiDeleteSlowdownCount, 1)
+				if attempt == multiDeleteAttempts {
+					atomic.AddInt32(&multiDeleteKeyErrors, int32(len(del.Objects)))
+					log.Printf("WARNING: giving up deleting objects %d to %d after %d slowdowns", first, last, attempt)
+					break
+				}
+				// Retry the same batch after a capped exponential backoff
+				time.Sleep(backoff)
+				if backoff *= 2; backoff > 10*time.Second {
+					backoff = 10 * time.Second
+				}
+				continue
+			} else if err != nil {
+				log.Fatalf("FATAL: Error deleting objects %d to %d: %v", first, last, err)
+			}
+			multiDeleteLatency.record(time.Since(start))
+			atomic.AddInt32(&multiDeleteRequests, 1)
+			// Quiet mode only reports the keys that failed
+			if len(res.Errors) > 0 {
+				atomic.AddInt32(&multiDeleteKeyErrors, int32(len(res.Errors)))
+				log.Printf("WARNING: %d of %d keys not deleted, first %s: %s %s", len(res.Errors), len(del.Objects),
+					aws.StringValue(res.Errors[0].Key), aws.StringValue(res.Errors[0].Code), aws.StringValue(res.Errors[0].Message))
+			}
+			break
+		}
+	}
+	// Remember last done time
+	multiDeleteFinish = time.Now()
+	// One less thread
+	atomic.AddInt32(&runningThreads, -1)
+}
+
+// runVersionPut -- write one more version of every versioned key
+func runVersionPut(thread_num int) {
+	client := getThreadS3Client(thread_num)
+	for {
+		objnum := atomic.AddInt32(&versionPutCount, 1)
+		if objnum > int32(versionKeys) {
+			break
+		}
+		start := time.Now()
+		res, err := client.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(objectKey.key(objnum)),
+			Body:   bytes.NewReader(objectData),
+		})
+		if err != nil {
+			atomic.AddInt32(&versionErrorCount, 1)
+			log.Printf("WARNING: versioned PUT %s failed: %v", objectKey.key(objnum), err)
+			continue
+		}
+		versionPutLatency.record(time.Since(start))
+		versionMu.Lock()
+		versionIds[objnum-1] = append(versionIds[objnum-1], aws.StringValue(res.VersionId))
+		versionMu.Unlock()
+	}
+	// One less thread
+	atomic.AddInt32(&runningThreads, -1)
+}
+
+// runVersionRead -- GET random versions and list the version chain of random keys
+func runVersionRead(thread_num int) {
+	client := getThreadS3Client(thread_num)
+	for time.Now().Before(endTime) {
+		objnum := rand.Int31n(int32(versionKeys)) + 1
+		key := aws.String(objectKey.key(objnum))
+		in := &s3.GetObjectInput{Bucket: aws.String(bucket), Key: key}
+		versionMu.Lock()
+		if ids := versionIds[objnum-1]; len(ids) > 0 && ids[0] != "" {
+			in.VersionId = aws.String(ids[rand.Intn(len(ids))])
+		}
+		versionMu.Unlock()
+
+		start := time.Now()
+		if res, err := client.GetObject(in); err != nil {
+			atomic.AddInt32(&versionErrorCount, 1)
+		} else {
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+			versionGetLatency.record(time.Since(start))
+			atomic.AddInt32(&versionGetCount, 1)
+		}
+
+		start = time.Now()
+		list, err := client.ListObjectVersions(&s3.ListObjectVersionsInput{Bucket: aws.String(bucket), Prefix: key, MaxKeys: aws.Int64(1000)})
+		if err != nil {
+			atomic.AddInt32(&versionErrorCount, 1)
+		} else {
+			versionListLatency.record(time.Since(start))
+			atomic.AddInt32(&versionListCount, 1)
+			// The prefix also matches longer keys like Object-10 for Object-1, only count the rows of the key
+			rows := 0
+			for _, version := range list.Versions {
+				if *version.Key == *key {
+					rows++
+				}
+			}
+			for _, marker := range list.DeleteMarkers {
+				if *marker.Key == *key {
+					rows++
+				}
+			}
+			atomic.AddInt64(&versionListRows, int64(rows))
+		}
+	}
+	// One less thread
+	atomic.AddInt32(&runningThreads, -1)
+}
+
+// runVersionDelete -- put a delete marker on every key, or with versions delete the oldest version of every key
+func runVersionDelete(versions bool) func(int) {
+	return func(thread_num int) {
+		client := getThreadS3Client(thread_num)
+		for {
+			objnum := atomic.AddInt32(&versionDeleteCount, 1)
+			if objnum > int32(versionKeys) {
+				break
+			}
+			in := &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(objectKey.key(objnum))}
+			latency := &versionMarkerLatency
+			if versions {
+				versionMu.Lock()
+				ids := versionIds[objnum-1]
+				if len(ids) > 0 {
+					in.VersionId = aws.String(ids[0])
+					versionIds[objnum-1] = ids[1:]
+				}
+				versionMu.Unlock()
+				if in.VersionId == nil {
+					continue
+				}
+				latency = &versionDeleteLatency
+			}
+			start := time.Now()
+			if _, err := client.DeleteObject(in); err != nil {
+				atomic.AddInt32(&versionErrorCount, 1)
+				log.Printf("WARNING: versioned DELETE %s failed: %v", aws.StringValue(in.Key), err)
+				continue
+			}
+			latency.record(time.Since(start))
+		}
+		// One less thread
+		atomic.AddInt32(&runningThreads, -1)
+	}
+}
+
+// runVersioned -- grow version chains of a set of keys and measure how GET and listing degrade
+func runVersioned() {
+	client := getS3Client()
+	if _, err := client.PutBucketVersioning(&s3.PutBucketVersioningInput{
+		Bucket:                  aws.String(bucket),
+		VersioningConfiguration: &s3.VersioningConfiguration{Status: aws.String(s3.BucketVersioningStatusEnabled)},
+	}); err != nil {
+		log.Fatalf("FATAL: Unable to enable versioning on bucket %s: %v", bucket, err)
+	}
+	versionIds = make([][]string, versionKeys)
+
+	for depth := 1; depth <= versionDepth; depth++ {
+		versionPutCount, versionGetCount, versionListCount, versionListRows, versionErrorCount = 0, 0, 0, 0, 0
+		versionPutLatency.reset()
+		versionGetLatency.reset()
+		versionListLatency.reset()
+
+		runThreads(threads, durationSecs, runVersionPut)
+		readTime := runThreads(threads, durationSecs, runVersionRead).Seconds()
+
+		rowsPerList := 0.0
+		if versionListCount > 0 {
+			rowsPerList = float64(versionListRows) / float64(versionListCount)
+		}
+		logit(fmt.Sprintf("Versions depth %d: PUT latency avg = %s; GET version ops = %d, %.1f operations/sec, latency avg = %s, p99 = %s; LISTver ops = %d, %.1f rows/list, latency avg = %s, p99 = %s. Errors = %d",
+			depth, versionPutLatency.mean(),
+			versionGetCount, float64(versionGetCount)/readTime, versionGetLatency.mean(), versionGetLatency.percentile(99),
+			versionListCount, rowsPerList, versionListLatency.mean(), versionListLatency.percentile(99), versionErrorCount))
+	}
+
+	// Delete markers hide the chains, then the oldest version of every key is removed for good
+	versionDeleteCount, versionErrorCount = 0, 0
+	markerTime := runThreads(threads, durationSecs, runVersionDelete(false)).Seconds()
+	versionDeleteCount = 0
+	deleteTime := runThreads(threads, durationSecs, runVersionDelete(true)).Seconds()
+	logit(fmt.Sprintf("Versions: delete markers time %.1f secs, latency avg = %s, p99 = %s; DELETE versionId time %.1f secs, latency avg = %s, p99 = %s. Errors = %d",
+		markerTime, versionMarkerLatency.mean(), versionMarkerLatency.percentile(99),
+		deleteTime, versionDeleteLatency.mean(), versionDeleteLatency.percentile(99), versionErrorCount))
+}
+
+// consistency check kinds, in the order a cycle runs them
+const (
+	checkGetAfterPut = iota
+	checkHeadAfterPut
+	checkListAfterPut
+	checkGetAfterOverwrite
+	checkGetAfterDelete
+	checkListAfterDelete
+	checkResurrected
+	checkKinds
+)
+
+// consistencyCheck -- how often a read did not show the last write, and how long until it did
+type consistencyCheck struct {
+	name      string
+	checks    int32
+	anomalies int32
+	diverged  int32
+	converge  latencyHistogram
+}
+
+var consistencyChecks = [checkKinds]*consistencyCheck{
+	{name: "GET after PUT"},
+	{name: "HEAD after PUT"},
+	{name: "LIST after PUT"},
+	{name: "GET after overwrite"},
+	{name: "GET after DELETE"},
+	{name: "LIST after DELETE"},
+	{name: "resurrected after DELETE"},
+}
+
+// check -- runs ok once, on anomaly polls until it converges or -consistency-wait passes
+func (c *consistencyCheck) check(key string, ok func() (bool, error)) {
+	atomic.AddInt32(&c.checks, 1)
+	start := time.Now()
+	good, err := ok()
+	if err != nil {
+		log.Fatalf("FATAL: %s %s failed: %v", c.name, key, err)
+	}
+	if good {
+		return
+	}
+	atomic.AddInt32(&c.anomalies, 1)
+	for time.Since(start) < consistencyWait {
+		time.Sleep(consistencyPoll)
+		if good, err = ok(); err != nil {
+			log.Fatalf("FATAL: %s %s failed: %v", c.name, key, err)
+		}
+		if good {
+			c.converge.record(time.Since(start))
+			return
+		}
+	}
+	atomic.AddInt32(&c.diverged, 1)
+	log.Printf("WARNING: %s %s did not converge within %s", c.name, key, consistencyWait)
+}
+
+// consistencyBody -- objectData stamped with object number and generation, so every write has its own ETag
+func consistencyBody(objnum int32, generation uint64) []byte {
+	body := append([]byte(nil), objectData...)
+	binary.BigEndian.PutUint64(body[0:8], uint64(objnum))
+	binary.BigEndian.PutUint64(body[8:16], generation)
+	return body
+}
+
+// runConsistencyCycle -- PUT, read it back, overwrite, delete, each step checked right after the write
+func runConsistencyCycle(thread_num int) {
+	client := getThreadS3Client(thread_num)
+	notFound := func(err error) bool {
+		reqErr, ok := err.(awserr.RequestFailure)
+		return ok && reqErr.StatusCode() == http.StatusNotFound
+	}
+	getEtag := func(key string) (string, error) {
+		res, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if notFound(err) {
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+		return aws.StringValue(res.ETag), nil
+	}
+	listed := func(key string) (bool, error) {
+		res, err := client.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(key), MaxKeys: aws.Int64(1)})
+		if err != nil {
+			return false, err
+		}
+		return len(res.Contents) > 0 && aws.StringValue(res.Contents[0].Key) == key, nil
+	}
+	put := func(key string, body []byte) string {
+		res, err := client.PutObject(&s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String(key), Body: bytes.NewReader(body)})
+		if err != nil {
+			log.Fatalf("FATAL: Error uploading object %s: %v", key, err)
+		}
+		return aws.StringValue(res.ETag)
+	}
+
+	for time.Now().Before(endTime) {
+		objnum := atomic.AddInt32(&consistencyCount, 1)
+		key := objectKey.key(objnum)
+
+		etag := put(key, consistencyBody(objnum, 1))
+		consistencyChecks[checkGetAfterPut].check(key, func() (bool, error) {
+			got, err := getEtag(key)
+			return got == etag, err
+		})
+		consistencyChecks[checkHeadAfterPut].check(key, func() (bool, error) {
+			res, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+			if notFound(err) {
+				return false, nil
+			}
+			return err == nil && aws.StringValue(res.ETag) == etag, err
+		})
+		consistencyChecks[checkListAfterPut].check(key, func() (bool, error) {
+			return listed(key)
+		})
+
+		// a stale read returns the first version
+		etag = put(key, consistencyBody(objnum, 2))
+		consistencyChecks[checkGetAfterOverwrite].check(key, func() (bool, error) {
+			got, err := getEtag(key)
+			return got == etag, err
+		})
+
+		if _, err := client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}); err != nil {
+			log.Fatalf("FATAL: Error deleting object %s: %v", key, err)
+		}
+		consistencyChecks[checkGetAfterDelete].check(key, func() (bool, error) {
+			got, err := getEtag(key)
+			return got == "", err
+		})
+		consistencyChecks[checkListAfterDelete].check(key, func() (bool, error) {
+			found, err := listed(key)
+			return !found, err
+		})
+		// once gone it must stay gone
+		time.Sleep(consistencyPoll)
+		consistencyChecks[checkResurrected].check(key, func() (bool, error) {
+			got, err := getEtag(key)
+			return got == "", err
+		})
+	}
+	// One less thread
+	atomic.AddInt32(&runningThreads, -1)
+}
+
+// runConsistency -- read-after-write, list-after-write and read-after-delete checks for -d seconds
+func runConsistency() {
+	elapsed := runThreads(threads, durationSecs, runConsistencyCycle).Seconds()
+	logit(fmt.Sprintf("Consistency: %d objects in %.1f secs, wait = %s, poll = %s",
+		consistencyCount, elapsed, consistencyWait, consistencyPoll))
+	for _, c := range consistencyChecks {
+		percent := 0.0
+		if c.checks > 0 {
+			percent = 100 * float64(c.anomalies) / float64(c.checks)
+		}
+		logit(fmt.Sprintf("Consistency %s: checks = %d, anomalies = %d (%.3f%%), converged avg = %s, p99 = %s, max = %s, never converged = %d",
+			c.name, c.checks, c.anomalies, percent, c.converge.mean(), c.converge.percentile(99), c.converge.percentile(100), c.diverged))
+	}
+}
+
+// conformanceCheck -- one S3 behavior, run returns how the endpoint differs from it
+type conformanceCheck struct {
+	group, name string
+	run         func(c *conformance) error
+}
+
+// conformance -- the client and buckets the checks run against, any endpoint incl. an in-process fake
+type conformance struct {
+	client        *s3.S3
+	bucket        string
+	versionBucket string
+	fixtures      sync.Once
+	fixturesErr   error
+	versions      sync.Once
+	versionsErr   error
+	versionIds    []string
+	createdBucket bool // versionBucket is new and deleted after the checks
+}
+
+const conformancePrefix = "conformance/"
+
+var conformanceListKeys = []string{"list/a", "list/b", "list/c", "list/d", "list/e"}
+var conformanceDirKeys = []string{"dir/a/1", "dir/a/2", "dir/b/1", "dir/c"}
+
+func (c *conformance) put(bucket, key, body string) (*s3.PutObjectOutput, error) {
+	return c.client.PutObject(&s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String(conformancePrefix + key), Body: strings.NewReader(body)})
+}
+
+func (c *conformance) get(in *s3.GetObjectInput) (*s3.GetObjectOutput, string, error) {
+	in.Key = aws.String(conformancePrefix + aws.StringValue(in.Key))
+	if in.Bucket == nil {
+		in.Bucket = aws.String(c.bucket)
+	}
+	res, err := c.client.GetObject(in)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	return res, string(body), err
+}
+
+// fixture -- objects of the listing checks
+func (c *conformance) fixture() error {
+	c.fixtures.Do(func() {
+		for _, key := range append(append([]string{}, conformanceListKeys...), conformanceDirKeys...) {
+			if _, err := c.put(c.bucket, key, key); err != nil {
+				c.fixturesErr = fmt.Errorf("fixture PUT %s: %v", key, err)
+				return
+			}
+		}
+	})
+	return c.fixturesErr
+}
+
+// versioned -- versioned bucket with two versions of key v and a delete marker on top
+func (c *conformance) versioned() error {
+	c.versions.Do(func() {
+		if _, err := c.client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(c.versionBucket)}); err == nil {
+			c.createdBucket = true
+		} else if !isBucketOwned(err) {
+			c.versionsErr = fmt.Errorf("CreateBucket %s: %v", c.versionBucket, err)
+			return
+		}
+		if _, err := c.client.PutBucketVersioning(&s3.PutBucketVersioningInput{
+			Bucket:                  aws.String(c.versionBucket),
+			VersioningConfiguration: &s3.VersioningConfiguration{Status: aws.String(s3.BucketVersioningStatusEnabled)},
+		}); err != nil {
+			c.versionsErr = fmt.Errorf("PutBucketVersioning: %v", err)
+			return
+		}
+		for _, body := range []string{"one", "two"} {
+			res, err := c.put(c.versionBucket, "v", body)
+			if err != nil {
+				c.versionsErr = fmt.Errorf("versioned PUT: %v", err)
+				return
+			}
+			c.versionIds = append(c.versionIds, aws.StringValue(res.VersionId))
+		}
+		if _, err := c.client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(c.versionBucket), Key: aws.String(conformancePrefix + "v")}); err != nil {
+			c.versionsErr = fmt.Errorf("versioned DELETE: %v", err)
+		}
+	})
+	return c.versionsErr
+}
+
+func isBucketOwned(err error) bool {
+	reqErr, ok := err.(awserr.RequestFailure)
+	return ok && reqErr.Code() == s3.ErrCodeBucketAlreadyOwnedByYou
+}
+
+// expectError -- err must be an S3 error with this status and code, code "" for responses without body
+func expectError(err error, status int, code string) error {
+	if err == nil {
+		return fmt.Errorf("expected %d %s, got success", status, code)
+	}
+	reqErr, ok := err.(awserr.RequestFailure)
+	if !ok {
+		return fmt.Errorf("expected %d %s, got %v", status, code, err)
+	}
+	if reqErr.StatusCode() != status || (code != "" && reqErr.Code() != code) {
+		return fmt.Errorf("expected %d %s, got %d %s", status, code, reqErr.StatusCode(), reqErr.Code())
+	}
+	return nil
+}
+
+func expectKeys(got []string, want ...string) error {
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		return fmt.Errorf("expected %v, got %v", want, got)
+	}
+	return nil
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// multipart -- starts an upload with the parts, aborted when the check is done
+func (c *conformance) multipart(key string, parts ...[]byte) (uploadId *string, completed []*s3.CompletedPart, abort func(), err error) {
+	in := &s3.CreateMultipartUploadInput{Bucket: aws.String(c.bucket), Key: aws.String(conformancePrefix + key)}
+	upload, err := c.client.CreateMultipartUpload(in)
+	if err != nil {
+		return nil, nil, func() {}, err
+	}
+	abort = func() {
+		c.client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{Bucket: in.Bucket, Key: in.Key, UploadId: upload.UploadId})
+	}
+	for n, part := range parts {
+		res, err := c.client.UploadPart(&s3.UploadPartInput{
+			Bucket: in.Bucket, Key: in.Key, UploadId: upload.UploadId,
+			PartNumber: aws.Int64(int64(n + 1)), Body: bytes.NewReader(part),
+		})
+		if err != nil {
+			return nil, nil, abort, err
+		}
+		completed = append(completed, &s3.CompletedPart{ETag: res.ETag, PartNumber: aws.Int64(int64(n + 1))})
+	}
+	return upload.UploadId, completed, abort, nil
+}
+
+func (c *conformance) complete(key string, uploadId *string, parts []*s3.CompletedPart) (*s3.CompleteMultipartUploadOutput, error) {
+	return c.client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket: aws.String(c.bucket), Key: aws.String(conformancePrefix + key), UploadId: uploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+}
+
+func (c *conformance) list(in *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, []string, error) {
+	if err := c.fixture(); err != nil {
+		return nil, nil, err
+	}
+	in.Bucket = aws.String(c.bucket)
+	in.Prefix = aws.String(conformancePrefix + aws.StringValue(in.Prefix))
+	if in.StartAfter != nil {
+		in.StartAfter = aws.String(conformancePrefix + aws.StringValue(in.StartAfter))
+	}
+	res, err := c.client.ListObjectsV2(in)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys := []string{}
+	for _, obj := range res.Contents {
+		keys = append(keys, strings.TrimPrefix(aws.StringValue(obj.Key), conformancePrefix))
+	}
+	return res, keys, nil
+}
+
+var conformanceChecks = []conformanceCheck{
+	// error codes, the SDK takes the code from the XML error body
+	{"errors", "GET missing key is 404 NoSuchKey", func(c *conformance) error {
+		_, _, err := c.get(&s3.GetObjectInput{Key: aws.String("missing")})
+		return expectError(err, 404, "NoSuchKey")
+	}},
+	{"errors", "GET in missing bucket is 404 NoSuchBucket", func(c *conformance) error {
+		_, _, err := c.get(&s3.GetObjectInput{Bucket: aws.String(c.bucket + "-missing"), Key: aws.String("missing")})
+		return expectError(err, 404, "NoSuchBucket")
+	}},
+	{"errors", "HEAD missing key is 404", func(c *conformance) error {
+		_, err := c.client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(c.bucket), Key: aws.String(conformancePrefix + "missing")})
+		return expectError(err, 404, "")
+	}},
+	{"errors", "PUT with wrong Content-MD5 is 400 BadDigest", func(c *conformance) error {
+		sum := md5.Sum([]byte("other content"))
+		_, err := c.client.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(c.bucket), Key: aws.String(conformancePrefix + "baddigest"),
+			Body: strings.NewReader("content"), ContentMD5: aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+		})
+		return expectError(err, 400, "BadDigest")
+	}},
+	{"errors", "GET range past the end is 416 InvalidRange", func(c *conformance) error {
+		if _, err := c.put(c.bucket, "range", "0123456789"); err != nil {
+			return err
+		}
+		_, _, err := c.get(&s3.GetObjectInput{Key: aws.String("range"), Range: aws.String("bytes=100-200")})
+		return expectError(err, 416, "InvalidRange")
+	}},
+	{"errors", "DELETE missing key is 204", func(c *conformance) error {
+		req, _ := c.client.DeleteObjectRequest(&s3.DeleteObjectInput{Bucket: aws.String(c.bucket), Key: aws.String(conformancePrefix + "missing")})
+		if err := req.Send(); err != nil {
+			return err
+		}
+		if req.HTTPResponse.StatusCode != http.StatusNoContent {
+			return fmt.Errorf("expected 204, got %d", req.HTTPResponse.StatusCode)
+		}
+		return nil
+	}},
+	{"errors", "CreateBucket with invalid name is 400 InvalidBucketName", func(c *conformance) error {
+		_, err := c.client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String("Invalid_Bucket_Name")})
+		if err == nil {
+			// A lenient server created it, don't leave it behind
+			c.client.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String("Invalid_Bucket_Name")})
+		}
+		return expectError(err, 400, "InvalidBucketName")
+	}},
+
+	// ListObjectsV2
+	{"list", "MaxKeys truncates with a continuation token", func(c *conformance) error {
+		res, keys, err := c.list(&s3.ListObjectsV2Input{Prefix: aws.String("list/"), MaxKeys: aws.Int64(2)})
+		if err != nil {
+			return err
+		}
+		if !aws.BoolValue(res.IsTruncated) || res.NextContinuationToken == nil || aws.Int64Value(res.KeyCount) != 2 {
+			return fmt.Errorf("expected truncated page of 2 with token, got truncated=%v token=%v keycount=%d",
+				aws.BoolValue(res.IsTruncated), res.NextContinuationToken != nil, aws.Int64Value(res.KeyCount))
+		}
+		return expectKeys(keys, "list/a", "list/b")
+	}},
+	{"list", "continuation pages return every key once, in order", func(c *conformance) error {
+		all := []string{}
+		var token *string
+		for page := 0; page < 10; page++ {
+			res, keys, err := c.list(&s3.ListObjectsV2Input{Prefix: aws.String("list/"), MaxKeys: aws.Int64(2), ContinuationToken: token})
+			if err != nil {
+				return err
+			}
+			all = append(all, keys...)
+			if !aws.BoolValue(res.IsTruncated) {
+				break
+			}
+			token = res.NextContinuationToken
+		}
+		return expectKeys(all, conformanceListKeys...)
+	}},
+	{"list", "delimiter groups keys into common prefixes", func(c *conformance) error {
+		res, keys, err := c.list(&s3.ListObjectsV2Input{Prefix: aws.String("dir/"), Delimiter: aws.String("/")})
+		if err != nil {
+			return err
+		}
+		prefixes := []string{}
+		for _, p := range res.CommonPrefixes {
+			prefixes = append(prefixes, strings.TrimPrefix(aws.StringValue(p.Prefix), conformancePrefix))
+		}
+		if err := expectKeys(prefixes, "dir/a/", "dir/b/"); err != nil {
+			return fmt.Errorf("common prefixes: %v", err)
+		}
+		return expectKeys(keys, "dir/c")
+	}},
+	{"list", "MaxKeys counts common prefixes too", func(c *conformance) error {
+		res, keys, err := c.list(&s3.ListObjectsV2Input{Prefix: aws.String("dir/"), Delimiter: aws.String("/"), MaxKeys: aws.Int64(1)})
+		if err != nil {
+			return err
+		}
+		if n := len(keys) + len(res.CommonPrefixes); n != 1 || !aws.BoolValue(res.IsTruncated) {
+			return fmt.Errorf("expected 1 entry and truncated, got %d entries, truncated=%v", n, aws.BoolValue(res.IsTruncated))
+		}
+		return nil
+	}},
+	{"list", "StartAfter skips keys up to and including it", func(c *conformance) error {
+		_, keys, err := c.list(&s3.ListObjectsV2Input{Prefix: aws.String("list/"), StartAfter: aws.String("list/b")})
+		if err != nil {
+			return err
+		}
+		return expectKeys(keys, "list/c", "list/d", "list/e")
+	}},
+	{"list", "prefix without match is empty and not truncated", func(c *conformance) error {
+		res, keys, err := c.list(&s3.ListObjectsV2Input{Prefix: aws.String("none/")})
+		if err != nil {
+			return err
+		}
+		if len(keys) != 0 || aws.BoolValue(res.IsTruncated) || aws.Int64Value(res.KeyCount) != 0 {
+			return fmt.Errorf("expected empty, got %v truncated=%v keycount=%d", keys, aws.BoolValue(res.IsTruncated), aws.Int64Value(res.KeyCount))
+		}
+		return nil
+	}},
+
+	// versioning
+	{"versions", "PUT returns a versionId", func(c *conformance) error {
+		if err := c.versioned(); err != nil {
+			return err
+		}
+		for _, id := range c.versionIds {
+			if id == "" || id == "null" {
+				return fmt.Errorf("expected versionIds, got %q", c.versionIds)
+			}
+		}
+		return nil
+	}},
+	{"versions", "ListObjectVersions shows versions under the latest delete marker", func(c *conformance) error {
+		if err := c.versioned(); err != nil {
+			return err
+		}
+		res, err := c.client.ListObjectVersions(&s3.ListObjectVersionsInput{Bucket: aws.String(c.versionBucket), Prefix: aws.String(conformancePrefix + "v")})
+		if err != nil {
+			return err
+		}
+		if len(res.Versions) != 2 || len(res.DeleteMarkers) != 1 {
+			return fmt.Errorf("expected 2 versions and 1 delete marker, got %d and %d", len(res.Versions), len(res.DeleteMarkers))
+		}
+		if !aws.BoolValue(res.DeleteMarkers[0].IsLatest) || aws.BoolValue(res.Versions[0].IsLatest) || aws.BoolValue(res.Versions[1].IsLatest) {
+			return fmt.Errorf("expected only the delete marker to be latest")
+		}
+		return nil
+	}},
+	{"versions", "key and versionId markers page through every version once", func(c *conformance) error {
+		if err := c.versioned(); err != nil {
+			return err
+		}
+		seen := map[string]bool{}
+		in := &s3.ListObjectVersionsInput{Bucket: aws.String(c.versionBucket), Prefix: aws.String(conformancePrefix + "v"), MaxKeys: aws.Int64(1)}
+		for page := 0; page < 10; page++ {
+			res, err := c.client.ListObjectVersions(in)
+			if err != nil {
+				return err
+			}
+			for _, v := range res.Versions {
+				seen[aws.StringValue(v.VersionId)] = true
+			}
+			for _, m := range res.DeleteMarkers {
+				seen[aws.StringValue(m.VersionId)] = true
+			}
+			if !aws.BoolValue(res.IsTruncated) {
+				break
+			}
+			if res.NextKeyMarker == nil || res.NextVersionIdMarker == nil {
+				return fmt.Errorf("truncated page without NextKeyMarker and NextVersionIdMarker")
+			}
+			in.KeyMarker, in.VersionIdMarker = res.NextKeyMarker, res.NextVersionIdMarker
+		}
+		if len(seen) != 3 {
+			return fmt.Errorf("expected 3 distinct versions, got %d", len(seen))
+		}
+		return nil
+	}},
+	{"versions", "GET of an old versionId returns that version", func(c *conformance) error {
+		if err := c.versioned(); err != nil {
+			return err
+		}
+		_, body, err := c.get(&s3.GetObjectInput{Bucket: aws.String(c.versionBucket), Key: aws.String("v"), VersionId: aws.String(c.versionIds[0])})
+		if err != nil {
+			return err
+		}
+		if body != "one" {
+			return fmt.Errorf("expected first version content, got %q", body)
+		}
+		return nil
+	}},
+	{"versions", "GET under a delete marker is 404 NoSuchKey", func(c *conformance) error {
+		if err := c.versioned(); err != nil {
+			return err
+		}
+		_, _, err := c.get(&s3.GetObjectInput{Bucket: aws.String(c.versionBucket), Key: aws.String("v")})
+		return expectError(err, 404, "NoSuchKey")
+	}},
+
+	// multipart
+	{"multipart", "ETag is md5 of the part md5s and the part count", func(c *conformance) error {
+		uploadId, parts, abort, err := c.multipart("mpu/etag", []byte("hello"))
+		defer abort()
+		if err != nil {
+			return err
+		}
+		res, err := c.complete("mpu/etag", uploadId, parts)
+		if err != nil {
+			return err
+		}
+		partMd5, _ := hex.DecodeString(md5Hex([]byte("hello")))
+		want := `"` + md5Hex(partMd5) + `-1"`
+		if aws.StringValue(res.ETag) != want {
+			return fmt.Errorf("expected %s, got %s", want, aws.StringValue(res.ETag))
+		}
+		return nil
+	}},
+	{"multipart", "parts out of order is 400 InvalidPartOrder", func(c *conformance) error {
+		uploadId, parts, abort, err := c.multipart("mpu/order", make([]byte, 5<<20), []byte("last"))
+		defer abort()
+		if err != nil {
+			return err
+		}
+		_, err = c.complete("mpu/order", uploadId, []*s3.CompletedPart{parts[1], parts[0]})
+		return expectError(err, 400, "InvalidPartOrder")
+	}},
+	{"multipart", "part below 5MB that is not the last is 400 EntityTooSmall", func(c *conformance) error {
+		uploadId, parts, abort, err := c.multipart("mpu/small", []byte("first"), []byte("last"))
+		defer abort()
+		if err != nil {
+			return err
+		}
+		_, err = c.complete("mpu/small", uploadId, parts)
+		return expectError(err, 400, "EntityTooSmall")
+	}},
+	{"multipart", "wrong part ETag is 400 InvalidPart", func(c *conformance) error {
+		uploadId, parts, abort, err := c.multipart("mpu/etagpart", []byte("only"))
+		defer abort()
+		if err != nil {
+			return err
+		}
+		parts[0].ETag = aws.String(`"00000000000000000000000000000000"`)
+		_, err = c.complete("mpu/etagpart", uploadId, parts)
+		return expectError(err, 400, "InvalidPart")
+	}},
+	{"multipart", "ListParts after abort is 404 NoSuchUpload", func(c *conformance) error {
+		uploadId, _, abort, err := c.multipart("mpu/abort", []byte("part"))
+		abort()
+		if err != nil {
+			return err
+		}
+		_, err = c.client.ListParts(&s3.ListPartsInput{Bucket: aws.String(c.bucket), Key: aws.String(conformancePrefix + "mpu/abort"), UploadId: uploadId})
+		return expectError(err, 404, "NoSuchUpload")
+	}},
+
+	// conditional requests
+	{"conditional", "GET If-None-Match current ETag is 304", func(c *conformance) error {
+		res, err := c.put(c.bucket, "cond", "conditional")
+		if err != nil {
+			return err
+		}
+		_, _, err = c.get(&s3.GetObjectInput{Key: aws.String("cond"), IfNoneMatch: res.ETag})
+		return expectError(err, 304, "")
+	}},
+	{"conditional", "GET If-Match other ETag is 412 PreconditionFailed", func(c *conformance) error {
+		if _, err := c.put(c.bucket, "cond", "conditional"); err != nil {
+			return err
+		}
+		_, _, err := c.get(&s3.GetObjectInput{Key: aws.String("cond"), IfMatch: aws.String(`"00000000000000000000000000000000"`)})
+		return expectError(err, 412, "PreconditionFailed")
+	}},
+	{"conditional", "GET If-Modified-Since last modified is 304", func(c *conformance) error {
+		if _, err := c.put(c.bucket, "cond", "conditional"); err != nil {
+			return err
+		}
+		head, err := c.client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(c.bucket), Key: aws.String(conformancePrefix + "cond")})
+		if err != nil {
+			return err
+		}
+		_, _, err = c.get(&s3.GetObjectInput{Key: aws.String("cond"), IfModifiedSince: head.LastModified})
+		return expectError(err, 304, "")
+	}},
+	{"conditional", "GET If-Unmodified-Since before last modified is 412", func(c *conformance) error {
+		if _, err := c.put(c.bucket, "cond", "conditional"); err != nil {
+			return err
+		}
+		_, _, err := c.get(&s3.GetObjectInput{Key: aws.String("cond"), IfUnmodifiedSince: aws.Time(time.Now().Add(-24 * time.Hour))})
+		return expectError(err, 412, "PreconditionFailed")
+	}},
+	{"conditional", "HEAD If-None-Match current ETag is 304", func(c *conformance) error {
+		res, err := c.put(c.bucket, "cond", "conditional")
+		if err != nil {
+			return err
+		}
+		_, err = c.client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(c.bucket), Key: aws.String(conformancePrefix + "cond"), IfNoneMatch: res.ETag})
+		return expectError(err, 304, "")
+	}},
+	{"conditional", "CopyObject copy-source-if-match other ETag is 412", func(c *conformance) error {
+		if _, err := c.put(c.bucket, "cond", "conditional"); err != nil {
+			return err
+		}
+		_, err := c.client.CopyObject(&s3.CopyObjectInput{
+			Bucket: aws.String(c.bucket), Key: aws.String(conformancePrefix + "cond-copy"),
+			CopySource:        aws.String(c.bucket + "/" + conformancePrefix + "cond"),
+			CopySourceIfMatch: aws.String(`"00000000000000000000000000000000"`),
+		})
+		return expectError(err, 412, "PreconditionFailed")
+	}},
+
+	// ETag formats
+	{"etag", "PUT ETag is the quoted md5 of the content", func(c *conformance) error {
+		res, err := c.put(c.bucket, "etag", "etag content")
+		if err != nil {
+			return err
+		}
+		if want := `"` + md5Hex([]byte("etag content")) + `"`; aws.StringValue(res.ETag) != want {
+			return fmt.Errorf("expected %s, got %s", want, aws.StringValue(res.ETag))
+		}
+		return nil
+	}},
+	{"etag", "GET and HEAD return the PUT ETag", func(c *conformance) error {
+		put, err := c.put(c.bucket, "etag", "etag content")
+		if err != nil {
+			return err
+		}
+		get, _, err := c.get(&s3.GetObjectInput{Key: aws.String("etag")})
+		if err != nil {
+			return err
+		}
+		head, err := c.client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(c.bucket), Key: aws.String(conformancePrefix + "etag")})
+		if err != nil {
+			return err
+		}
+		if aws.StringValue(get.ETag) != aws.StringValue(put.ETag) || aws.StringValue(head.ETag) != aws.StringValue(put.ETag) {
+			return fmt.Errorf("PUT %s, GET %s, HEAD %s", aws.StringValue(put.ETag), aws.StringValue(get.ETag), aws.StringValue(head.ETag))
+		}
+		return nil
+	}},
+	{"etag", "range GET returns the bytes and Content-Range", func(c *conformance) error {
+		if _, err := c.put(c.bucket, "range", "0123456789"); err != nil {
+			return err
+		}
+		res, body, err := c.get(&s3.GetObjectInput{Key: aws.String("range"), Range: aws.String("bytes=2-5")})
+		if err != nil {
+			return err
+		}
+		if body != "2345" || aws.StringValue(res.ContentRange) != "bytes 2-5/10" {
+			return fmt.Errorf("expected 2345 and bytes 2-5/10, got %q and %q", body, aws.StringValue(res.ContentRange))
+		}
+		return nil
+	}},
+	{"etag", "CopyObject keeps the ETag of a single part source", func(c *conformance) error {
+		put, err := c.put(c.bucket, "etag", "etag content")
+		if err != nil {
+			return err
+		}
+		res, err := c.client.CopyObject(&s3.CopyObjectInput{
+			Bucket: aws.String(c.bucket), Key: aws.String(conformancePrefix + "etag-copy"),
+			CopySource: aws.String(c.bucket + "/" + conformancePrefix + "etag"),
+		})
+		if err != nil {
+			return err
+		}
+		if res.CopyObjectResult == nil || aws.StringValue(res.CopyObjectResult.ETag) != aws.StringValue(put.ETag) {
+			return fmt.Errorf("expected %s, got %v", aws.StringValue(put.ETag), res.CopyObjectResult)
+		}
+		return nil
+	}},
+}
+
+// runConformance -- runs every check against the client and prints the pass/fail matrix, returns the number of failures
+func runConformance(client *s3.S3, bucket string) int {
+	c := &conformance{client: client, bucket: bucket, versionBucket: bucket + "-versioned"}
+	if _, err := client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(bucket)}); err != nil && !isBucketOwned(err) {
+		log.Printf("WARNING: CreateBucket %s error, ignoring %v", bucket, err)
+	}
+	failed := 0
+	fmt.Printf("%-12s %-65s %s\n", "GROUP", "CHECK", "RESULT")
+	for _, check := range conformanceChecks {
+		result := "PASS"
+		if err := check.run(c); err != nil {
+			failed++
+			result = "FAIL " + err.Error()
+		}
+		fmt.Printf("%-12s %-65s %s\n", check.group, check.name, result)
+	}
+	// Only remove what the checks wrote, the buckets may hold other data
+	deleteObjects(client, bucket, conformancePrefix, "")
+	if c.createdBucket || c.versionsErr == nil {
+		deleteObjects(client, c.versionBucket, conformancePrefix, "")
+	}
+	if c.createdBucket {
+		if _, err := client.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String(c.versionBucket)}); err != nil {
+			log.Printf("WARNING: DeleteBucket %s error, leaving it behind: %v", c.versionBucket, err)
+		}
+	}
+	logit(fmt.Sprintf("Conformance: %d checks, %d passed, %d failed", len(conformanceChecks), len(conformanceChecks)-failed, failed))
+	return failed
+}
+
+// datasetKey -- object in the bucket describing the objects prepare uploaded
+const datasetKey = ".s3-benchmark-dataset"
+
+// datasetLayout -- what a benchmark needs to find the objects of a prepared dataset again
+type datasetLayout struct {
+	Size                      uint64
+	Key, Template             string
+	PrefixLen, Levels, Fanout int
+	DateStep                  time.Duration
+}
+
+type datasetMarker struct {
+	datasetLayout
+	Salt    uint64
+	Epoch   time.Time
+	Objects int32
+}
+
+// currentLayout -- the dataset layout of the -z and -key flags
+func currentLayout() datasetLayout {
+	return datasetLayout{objectSize, keyScheme, keyTemplate, keyPrefixLen, keyLevels, keyFanout, keyDateStep}
+}
+
+// useLayout -- switch object size and key naming to those of a prepared dataset
+func (d *datasetMarker) useLayout() {
+	objectSize, keyScheme, keyTemplate = d.Size, d.Key, d.Template
+	keyPrefixLen, keyLevels, keyFanout, keyDateStep = d.PrefixLen, d.Levels, d.Fanout, d.DateStep
+	keySalt, keyEpoch = d.Salt, d.Epoch
+}
+
+// readDataset -- the dataset marker of the bucket, nil when there is none
+func readDataset(client *s3.S3) *datasetMarker {
+	res, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(datasetKey)})
+	if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == http.StatusNotFound {
+		return nil
+	} else if err != nil {
+		log.Fatalf("FATAL: Unable to read the dataset of bucket %s: %v", bucket, err)
+	}
+	defer res.Body.Close()
+	dataset := &datasetMarker{}
+	if err := json.NewDecoder(res.Body).Decode(dataset); err != nil {
+		log.Fatalf("FATAL: Invalid dataset in bucket %s: %v", bucket, err)
+	}
+	return dataset
+}
+
+func writeDataset(client *s3.S3, dataset *datasetMarker) {
+	body, _ := json.Marshal(dataset)
+	if _, err := client.PutObject(&s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String(datasetKey), Body: bytes.NewReader(body)}); err != nil {
+		log.Fatalf("FATAL: Unable to save the dataset of bucket %s: %v", bucket, err)
+	}
+}
+
+// prepareProgress -- uploaded objects, done is the highest object number with all objects up to it uploaded
+type prepareProgress struct {
+	mu       sync.Mutex
+	next     int32
+	done     int32
+	uploaded int32
+	finished map[int32]bool
+}
+
+func (p *prepareProgress) complete(objnum int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.uploaded++
+	p.finished[objnum] = true
+	for p.finished[p.done+1] {
+		delete(p.finished, p.done+1)
+		p.done++
+	}
+}
+
+// runPrepareUpload -- PUT the next objects up to target, slowdowns are retried as the dataset needs every object
+func runPrepareUpload(thread_num int, progress *prepareProgress, target int32) {
+	threadLimit, _ := threadThrottles(thread_num)
+	for {
+		objnum := atomic.AddInt32(&progress.next, 1)
+		if objnum > target {
+			break
+		}
+		for backoff := 100 * time.Millisecond; ; backoff *= 2 {
+			prefix := objectUrl(objnum)
+			req, _ := http.NewRequest("PUT", prefix, throttleReader(bytes.NewReader(objectData), threadLimit, uploadLimit))
+			req.ContentLength = int64(objectSize)
+			req.Header.Set("Content-MD5", objectDataMd5)
+			setSignature(req)
+			resp, err := threadHTTPClient(thread_num).Do(req)
+			if err != nil {
+				log.Fatalf("FATAL: Error preparing object %s: %v", prefix, err)
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				break
+			}
+			if resp.StatusCode != http.StatusServiceUnavailable {
+				log.Fatalf("FATAL: Error preparing object %s: %s", prefix, resp.Status)
+			}
+			if backoff > 10*time.Second {
+				backoff = 10 * time.Second
+			}
+			time.Sleep(backoff)
+		}
+		progress.complete(objnum)
+	}
+	atomic.AddInt32(&runningThreads, -1)
+}
+
+// runPrepare -- upload objects until the bucket holds target of them, the progress is saved in the bucket
+// every few seconds so an interrupted prepare continues where it stopped
+func runPrepare(client *s3.S3, dataset *datasetMarker, target int32) {
+	if dataset.Objects >= target {
+		logit(fmt.Sprintf("Prepare: bucket %s already holds %d objects of %sB", bucket, dataset.Objects, bytefmt.ByteSize(objectSize)))
+		return
+	}
+	logit(fmt.Sprintf("Prepare: %d objects of %sB (%sB) in bucket %s, key=%s, starting at object %d",
+		target, bytefmt.ByteSize(objectSize), bytefmt.ByteSize(uint64(target)*objectSize), bucket, keyScheme, dataset.Objects+1))
+	progress := &prepareProgress{next: dataset.Objects, done: dataset.Objects, finished: map[int32]bool{}}
+	start := time.Now()
+	runningThreads = int32(threads)
+	for n := 1; n <= threads; n++ {
+		go runPrepareUpload(n, progress, target)
+	}
+	report := func() {
+		progress.mu.Lock()
+		dataset.Objects = progress.done
+		uploaded := progress.uploaded
+		progress.mu.Unlock()
+		writeDataset(client, dataset)
+		rate := float64(uploaded) / time.Since(start).Seconds()
+		eta := "-"
+		if rate > 0 {
+			eta = (time.Duration(float64(target-dataset.Objects)/rate) * time.Second).String()
+		}
+		logit(fmt.Sprintf("Prepare: %d of %d objects (%.1f%%), %sB of %sB, %.1f objects/sec, remaining %s",
+			dataset.Objects, target, 100*float64(dataset.Objects)/float64(target), bytefmt.ByteSize(uint64(dataset.Objects)*objectSize),
+			bytefmt.ByteSize(uint64(target)*objectSize), rate, eta))
+	}
+	for last := time.Now(); atomic.LoadInt32(&runningThreads) > 0; time.Sleep(time.Millisecond) {
+		if time.Since(last) >= 5*time.Second {
+			report()
+			last = time.Now()
+		}
+	}
+	report()
+}
+
+// phaseCounters -- what a phase did so far, the same for every phase so agents can report any of them
+type phaseCounters struct {
+	Ops, Bytes, Rows, Slowdowns, Errors int64
+}
+
+func (c phaseCounters) add(o phaseCounters) phaseCounters {
+	return phaseCounters{c.Ops + o.Ops, c.Bytes + o.Bytes, c.Rows + o.Rows, c.Slowdowns + o.Slowdowns, c.Errors + o.Errors}
+}
+
+func (c phaseCounters) sub(o phaseCounters) phaseCounters {
+	return phaseCounters{c.Ops - o.Ops, c.Bytes - o.Bytes, c.Rows - o.Rows, c.Slowdowns - o.Slowdowns, c.Errors - o.Errors}
+}
+
+// describe -- the counters over the given seconds, leaving out what the phase does not have
+func (c phaseCounters) describe(seconds float64, latency *latencyHistogram) string {
+	s := fmt.Sprintf("ops = %d, %.1f operations/sec", c.Ops, float64(c.Ops)/seconds)
+	if c.Bytes > 0 {
+		s += fmt.Sprintf(", speed = %sB/sec", byteRate(float64(c.Bytes)/seconds))
+	}
+	if c.Rows > 0 {
+		s += fmt.Sprintf(", rows = %d, %.1f rows/sec", c.Rows, float64(c.Rows)/seconds)
+	}
+	if latency != nil && latency.count > 0 {
+		s += fmt.Sprintf(", latency avg = %s, p50 = %s, p99 = %s", latency.mean(), latency.percentile(50), latency.percentile(99))
+	}
+	return s + fmt.Sprintf(". Slowdowns = %d, Errors = %d", c.Slowdowns, c.Errors)
+}
+
+// agentPhase -- one test phase as an agent runs it for the coordinator
+type agentPhase struct {
+	op       string
+	runner   func(int)
+	finish   *time.Time
+	latency  *latencyHistogram
+	counters func() phaseCounters
+	reset    func()
+}
+
+// atMost -- counters that run past the uploaded objects, like the delete ones, capped to them
+func atMost(n, limit int32) int64 {
+	if n > limit {
+		return int64(limit)
+	}
+	return int64(n)
+}
+
+var agentPhases = map[string]agentPhase{
+	"put": {"PUT", runUpload, &uploadFinish, &uploadLatency, func() phaseCounters {
+		n := int64(atomic.LoadInt32(&uploadCount))
+		return phaseCounters{Ops: n, Bytes: n * int64(objectSize), Slowdowns: int64(atomic.LoadInt32(&uploadSlowdownCount))}
+	}, func() {
+		uploadCount, uploadSlowdownCount = 0, 0
+		uploadLatency.reset()
+	}},
+	"get": {"GET", runDownload, &downloadFinish, &downloadLatency, func() phaseCounters {
+		n := int64(atomic.LoadInt32(&downloadCount))
+		return phaseCounters{Ops: n, Bytes: n * int64(objectSize), Slowdowns: int64(atomic.LoadInt32(&downloadSlowdownCount)), Errors: int64(atomic.LoadInt32(&downloadErrorCount))}
+	}, func() {
+		downloadCount, downloadSlowdownCount, downloadErrorCount = 0, 0, 0
+		downloadLatency.reset()
+	}},
+	"head": {"HEAD", runHead, &headFinish, &headLatency, func() phaseCounters {
+		return phaseCounters{Ops: int64(atomic.LoadInt32(&headCount)), Slowdowns: int64(atomic.LoadInt32(&headSlowdownCount)), Errors: int64(atomic.LoadInt32(&headErrorCount))}
+	}, func() {
+		headCount, headSlowdownCount, headErrorCount = 0, 0, 0
+		headLatency.reset()
+	}},
+	"copy": {"COPY", runCopy, &copyFinish, &copyLatency, func() phaseCounters {
+		n := int64(atomic.LoadInt32(&copyCount))
+		return phaseCounters{Ops: n, Bytes: n * int64(objectSize), Slowdowns: int64(atomic.LoadInt32(&copySlowdownCount)), Errors: int64(atomic.LoadInt32(&copyErrorCount))}
+	}, func() {
+		copyCount, copySlowdownCount, copyErrorCount = 0, 0, 0
+		copyLatency.reset()
+	}},
+	"list2": {"LIST2", runListObjectsV2, &listObjFinish, nil, func() phaseCounters {
+		return phaseCounters{Ops: int64(atomic.LoadInt32(&listObjCount)), Rows: int64(atomic.LoadUint64(&listObjRowsCount)), Slowdowns: int64(atomic.LoadInt32(&listObjSlowdownCount))}
+	}, func() {
+		listObjCount, listObjRowsCount, listObjSlowdownCount = 0, 0, 0
+	}},
+	"listver": {"LISTver", runListingVersions, &listVerFinish, nil, func() phaseCounters {
+		return phaseCounters{Ops: int64(atomic.LoadInt32(&listVerCount)), Rows: int64(atomic.LoadUint64(&listVerRowsCount)), Slowdowns: int64(atomic.LoadInt32(&listVerSlowdownCount))}
+	}, func() {
+		listVerCount, listVerRowsCount, listVerSlowdownCount = 0, 0, 0
+	}},
+	"delete": {"DELETE", runDelete, &deleteFinish, nil, func() phaseCounters {
+		return phaseCounters{Ops: atMost(atomic.LoadInt32(&deleteCount), uploadCount), Slowdowns: int64(atomic.LoadInt32(&deleteSlowdownCount))}
+	}, func() {
+		deleteCount, deleteSlowdownCount = 0, 0
+	}},
+	"multidelete": {"MULTIDELETE", runMultiDelete, &multiDeleteFinish, &multiDeleteLatency, func() phaseCounters {
+		return phaseCounters{Ops: int64(atomic.LoadInt32(&multiDeleteRequests)), Rows: atMost(atomic.LoadInt32(&multiDeleteCount), uploadCount),
+			Slowdowns: int64(atomic.LoadInt32(&multiDeleteSlowdownCount)), Errors: int64(atomic.LoadInt32(&multiDeleteKeyErrors))}
+	}, func() {
+		multiDeleteCount, multiDeleteRequests, multiDeleteSlowdownCount, multiDeleteKeyErrors = 0, 0, 0, 0
+		multiDeleteLatency.reset()
+	}},
+}
+
+// phaseOrder -- the order the test loop runs the phases in
+var phaseOrder = []string{"put", "get", "head", "copy", "list2", "listver", "delete", "multidelete"}
+
+// agentStartDelay -- time between scheduling a phase and its start on all agents
+const agentStartDelay = 2 * time.Second
+
+// agentTokenHeader -- request header with the -token shared by the coordinator and its agents
+const agentTokenHeader = "X-Benchmark-Token"
+
+// agentMu -- one setup or phase at a time, agents in one process share the counters
+var agentMu sync.Mutex
+
+type agentSetup struct {
+	Index, Agents int
+}
+
+type agentPhaseRequest struct {
+	Loop    int
+	Phase   string
+	Start   int64
+	Seconds int
+}
+
+// agentMessage -- one line of the stream an agent answers a phase request with, intervals until the result
+type agentMessage struct {
+	Interval int            `json:",omitempty"`
+	Delta    *phaseCounters `json:",omitempty"`
+	Result   *agentResult   `json:",omitempty"`
+}
+
+type agentResult struct {
+	Seconds  float64
+	Counters phaseCounters
+	Latency  latencySnapshot
+	Threads  int
+}
+
+// runAgent -- serve phases to a coordinator, the flags of the agent decide how the phases run
+func runAgent() {
+	logit(fmt.Sprintf("Agent: listening on %s", agentListen))
+	log.Fatal(http.ListenAndServe(agentListen, agentMux()))
+}
+
+// agentMux -- the requests of the coordinator, refused without the shared token
+func agentMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	handle := func(path string, handler http.HandlerFunc) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get(agentTokenHeader)), []byte(agentToken)) != 1 {
+				http.Error(w, "wrong or missing -token", http.StatusForbidden)
+				return
+			}
+			handler(w, r)
+		})
+	}
+	handle("/clock", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(time.Now().UnixNano())
+	})
+	handle("/setup", func(w http.ResponseWriter, r *http.Request) {
+		var setup agentSetup
+		if err := json.NewDecoder(r.Body).Decode(&setup); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		agentMu.Lock()
+		defer agentMu.Unlock()
+		// All agents read the same prepared objects
+		if useDataset {
+			logit(fmt.Sprintf("Agent: %d of %d, dataset of %d objects", setup.Index, setup.Agents, datasetObjects))
+			return
+		}
+		// Every agent writes its own keys into the shared bucket
+		objectKey.suffix = fmt.Sprintf("-agent%d", setup.Index)
+		logit(fmt.Sprintf("Agent: %d of %d, key suffix %s", setup.Index, setup.Agents, objectKey.suffix))
+		createBucket(bucket, true)
+		if copyBucket != bucket {
+			createBucket(copyBucket, true)
+		}
+		if setup.Index == 1 {
+			deleteAllObjects(getS3Client(), bucket)
+			if copyBucket != bucket {
+				deleteAllObjects(getS3Client(), copyBucket)
+			}
+		}
+		reportPhase("Setup:")
+	})
+	handle("/phase", func(w http.ResponseWriter, r *http.Request) {
+		var req agentPhaseRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		phase, ok := agentPhases[req.Phase]
+		if !ok || req.Seconds < 1 {
+			http.Error(w, fmt.Sprintf("unknown phase %q or duration %d", req.Phase, req.Seconds), http.StatusBadRequest)
+			return
+		}
+		if useDataset && (req.Phase == "put" || req.Phase == "delete" || req.Phase == "multidelete") {
+			http.Error(w, fmt.Sprintf("the %s phase would change the dataset", req.Phase), http.StatusBadRequest)
+			return
+		}
+		agentMu.Lock()
+		defer agentMu.Unlock()
+		phase.reset()
+		// A phase that starts late, eg. after another one in this process, still runs the full duration
+		startTime := time.Unix(0, req.Start)
+		if now := time.Now(); startTime.Before(now) {
+			startTime = now
+		}
+		time.Sleep(time.Until(startTime))
+		runningThreads = int32(threads)
+		endTime = startTime.Add(time.Second * time.Duration(req.Seconds))
+		for n := 1; n <= threads; n++ {
+			go phase.runner(n)
+		}
+
+		// Stream what happened in every second while the phase runs
+		encoder := json.NewEncoder(w)
+		flusher, _ := w.(http.Flusher)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		var last phaseCounters
+		for interval := 1; atomic.LoadInt32(&runningThreads) > 0; {
+			select {
+			case <-ticker.C:
+				now := phase.counters()
+				delta := now.sub(last)
+				encoder.Encode(agentMessage{Interval: interval, Delta: &delta})
+				if flusher != nil {
+					flusher.Flush()
 				}
+				last = now
+				interval++
+			default:
+				time.Sleep(time.Millisecond)
 			}
 		}
-	}
-	// Remember last done time
-	uploadFinish = time.Now()
-	// One less thread
-	atomic.AddInt32(&runningThreads, -1)
+		result := agentResult{Seconds: phase.finish.Sub(startTime).Seconds(), Counters: phase.counters(), Threads: threads}
+		if phase.latency != nil {
+			result.Latency = phase.latency.snapshot()
+		}
+		logit(fmt.Sprintf("Loop %d: %s time %.1f secs, %s", req.Loop, phase.op, result.Seconds, result.Counters.describe(result.Seconds, phase.latency)))
+		reportPhase(fmt.Sprintf("Loop %d: %s", req.Loop, phase.op))
+		if req.Phase == "copy" {
+			deleteCopies()
+		}
+		encoder.Encode(agentMessage{Result: &result})
+	})
+	return mux
 }
 
-func runDownload(thread_num int) {
-	for time.Now().Before(endTime) {
-		atomic.AddInt32(&downloadCount, 1)
-		objnum := rand.Int31n(downloadCount) + 1
-		prefix := fmt.Sprintf("%s/%s/Object-%d", urlHost, bucket, objnum)
-		req, _ := http.NewRequest("GET", prefix, nil)
-		setSignature(req)
-		if resp, err := httpClient.Do(req); err != nil {
-			log.Fatalf("FATAL: Error downloading object %s: %v", prefix, err)
-		} else if resp != nil && resp.Body != nil {
-			if resp.StatusCode == http.StatusServiceUnavailable {
-				atomic.AddInt32(&downloadSlowdownCount, 1)
-				atomic.AddInt32(&downloadCount, -1)
-			} else {
-				io.Copy(ioutil.Discard, resp.Body)
-			}
-		}
+// coordinatedAgent -- an agent as the coordinator sees it
+type coordinatedAgent struct {
+	addr   string
+	offset time.Duration
+	result agentResult
+}
+
+// agentCall -- POST a JSON request with the shared token to an agent
+func agentCall(addr, path string, req interface{}) (*http.Response, error) {
+	body, _ := json.Marshal(req)
+	httpReq, err := http.NewRequest(http.MethodPost, "http://"+addr+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
 	}
-	// Remember last done time
-	downloadFinish = time.Now()
-	// One less thread
-	atomic.AddInt32(&runningThreads, -1)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(agentTokenHeader, agentToken)
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err == nil && resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, err
 }
 
-func runListingVersions(thread_num int) {
-	var keyMarker, versionId, delimiter *string
-	objnum := rand.Int31n(downloadCount) + 1
-	prefix := fmt.Sprintf(`Object-%d`, objnum%100)
-	client := getS3Client()
-	delimiterCounter := 0
-	for time.Now().Before(endTime) {
-		atomic.AddInt32(&listVerCount, 1)
-		in := &s3.ListObjectVersionsInput{
-			Bucket:          aws.String(bucket),
-			KeyMarker:       keyMarker,
-			VersionIdMarker: versionId,
-			MaxKeys:         aws.Int64(1000),
-			Prefix:          &prefix,
-			Delimiter:       delimiter,
+// runCoordinator -- run the test loop on all agents at once and merge what they report
+func runCoordinator(addrs []string, phasesArg string) {
+	var run []string
+	wanted := map[string]bool{}
+	for _, phase := range strings.Split(phasesArg, ",") {
+		if _, ok := agentPhases[phase]; !ok {
+			log.Fatalf("Invalid -phases argument, unknown phase %q", phase)
+		}
+		wanted[phase] = true
+	}
+	for _, phase := range phaseOrder {
+		if wanted[phase] {
+			run = append(run, phase)
 		}
-		res, err := client.ListObjectVersions(in)
+	}
+	if !useDataset && !wanted["put"] && (wanted["get"] || wanted["head"] || wanted["copy"]) {
+		log.Fatal("The get, head and copy phases need the put phase to upload objects, or -dataset for prepared ones.")
+	}
+	logit(fmt.Sprintf("Coordinator: agents=%s, duration=%d, loops=%d, phases=%s", strings.Join(addrs, ","), durationSecs, loops, strings.Join(run, ",")))
+
+	// Clock offset of every agent from the middle of the round trip, phases start at the same time on all of them
+	agents := make([]*coordinatedAgent, len(addrs))
+	for i, addr := range addrs {
+		agents[i] = &coordinatedAgent{addr: addr}
+		sent := time.Now()
+		resp, err := agentCall(addr, "/clock", nil)
 		if err != nil {
-			atomic.AddInt32(&listVerSlowdownCount, 1)
-			atomic.AddInt32(&listVerCount, -1)
-			log.Printf(`WARNING: failed %v %s`, in, err)
+			log.Fatalf("FATAL: Agent %s clock request: %v", addr, err)
 		}
-		if res != nil {
-			total := uint64(len(res.Versions) + len(res.CommonPrefixes))
-			atomic.AddUint64(&listVerRowsCount, total)
+		var clock int64
+		err = json.NewDecoder(resp.Body).Decode(&clock)
+		resp.Body.Close()
+		if err != nil {
+			log.Fatalf("FATAL: Agent %s clock: %v", addr, err)
 		}
-		if res == nil || len(res.Versions) == 0 || res.KeyMarker == nil || res.NextKeyMarker == nil {
-			objnum = rand.Int31n(downloadCount) + 1
-			prefix = fmt.Sprintf(`Object-%d`, objnum%100)
-			delimiterCounter++
-			delimiterCounter %= 10
-			if delimiterCounter > 7 {
-				delimiter = nil
-			} else {
-				delimiter = aws.String(fmt.Sprint(delimiterCounter))
+		agents[i].offset = time.Unix(0, clock).Sub(sent.Add(time.Since(sent) / 2))
+		logit(fmt.Sprintf("Agent %s: clock offset %s", addr, agents[i].offset))
+	}
+
+	// Set up all agents before the first phase, the first one empties the bucket
+	var wg sync.WaitGroup
+	for i, agent := range agents {
+		wg.Add(1)
+		go func(i int, agent *coordinatedAgent) {
+			defer wg.Done()
+			resp, err := agentCall(agent.addr, "/setup", agentSetup{Index: i + 1, Agents: len(agents)})
+			if err != nil {
+				log.Fatalf("FATAL: Agent %s setup: %v", agent.addr, err)
 			}
-		} else {
-			keyMarker = res.NextKeyMarker
-			versionId = res.NextVersionIdMarker
+			resp.Body.Close()
+		}(i, agent)
+	}
+	wg.Wait()
+
+	for loop := 1; loop <= loops; loop++ {
+		for _, phase := range run {
+			runCoordinatedPhase(agents, loop, phase)
 		}
 	}
-	// Remember last done time
-	listVerFinish = time.Now()
-	// One less thread
-	atomic.AddInt32(&runningThreads, -1)
 }
 
-func runListObjectsV2(thread_num int) {
-	var continuationToken, delimiter *string
-	objnum := rand.Int31n(downloadCount) + 1
-	prefix := fmt.Sprintf(`Object-%d`, objnum%100)
-	client := getS3Client()
-	delimiterCounter := 0
-	for time.Now().Before(endTime) {
-		atomic.AddInt32(&listObjCount, 1)
-		in := &s3.ListObjectsV2Input{
-			Bucket:            aws.String(bucket),
-			MaxKeys:           aws.Int64(1000),
-			Prefix:            &prefix,
-			ContinuationToken: continuationToken,
-			Delimiter:         delimiter,
-		}
-		res, err := client.ListObjectsV2(in)
-		if err != nil {
-			atomic.AddInt32(&listObjSlowdownCount, 1)
-			atomic.AddInt32(&listObjCount, -1)
-			log.Printf(`WARNING: failed %v %s`, in, err)
-		}
-		if res != nil {
-			total := uint64(len(res.Contents) + len(res.CommonPrefixes))
-			atomic.AddUint64(&listObjRowsCount, total)
-		}
-		if res == nil || len(res.Contents) == 0 || res.NextContinuationToken == nil {
-			objnum = rand.Int31n(downloadCount) + 1
-			prefix = fmt.Sprintf(`Object-%d`, objnum%100)
-			delimiterCounter++
-			delimiterCounter %= 10
-			if delimiterCounter > 7 {
-				delimiter = nil
-			} else {
-				delimiter = aws.String(fmt.Sprint(delimiterCounter))
+// runCoordinatedPhase -- one phase on all agents with a line per second, returns the merged result
+func runCoordinatedPhase(agents []*coordinatedAgent, loop int, phase string) agentResult {
+	type update struct {
+		agent *coordinatedAgent
+		msg   agentMessage
+	}
+	updates := make(chan update)
+	start := time.Now().Add(agentStartDelay)
+	for _, agent := range agents {
+		go func(agent *coordinatedAgent) {
+			req := agentPhaseRequest{Loop: loop, Phase: phase, Start: start.Add(agent.offset).UnixNano(), Seconds: durationSecs}
+			resp, err := agentCall(agent.addr, "/phase", req)
+			if err != nil {
+				log.Fatalf("FATAL: Agent %s %s phase: %v", agent.addr, phase, err)
 			}
+			defer resp.Body.Close()
+			decoder := json.NewDecoder(resp.Body)
+			for {
+				var msg agentMessage
+				if err := decoder.Decode(&msg); err != nil {
+					log.Fatalf("FATAL: Agent %s %s phase stream: %v", agent.addr, phase, err)
+				}
+				updates <- update{agent, msg}
+				if msg.Result != nil {
+					return
+				}
+			}
+		}(agent)
+	}
+
+	// An interval is complete once every agent still running sent it
+	label := fmt.Sprintf("Loop %d: %s", loop, agentPhases[phase].op)
+	intervals := map[int]*phaseCounters{}
+	reported := map[int]int{}
+	running, next := len(agents), 1
+	for running > 0 {
+		u := <-updates
+		if u.msg.Result != nil {
+			u.agent.result = *u.msg.Result
+			running--
 		} else {
-			continuationToken = res.NextContinuationToken
+			if intervals[u.msg.Interval] == nil {
+				intervals[u.msg.Interval] = &phaseCounters{}
+			}
+			*intervals[u.msg.Interval] = intervals[u.msg.Interval].add(*u.msg.Delta)
+			reported[u.msg.Interval]++
+		}
+		for ; intervals[next] != nil && reported[next] >= running; next++ {
+			c := intervals[next]
+			logit(fmt.Sprintf("%s %ds: %s", label, next, c.describe(1, nil)))
 		}
 	}
-	// Remember last done time
-	listObjFinish = time.Now()
-	// One less thread
-	atomic.AddInt32(&runningThreads, -1)
-}
 
-func runDelete(thread_num int) {
-	for {
-		objnum := atomic.AddInt32(&deleteCount, 1)
-		if objnum > uploadCount {
-			break
-		}
-		prefix := fmt.Sprintf("%s/%s/Object-%d", urlHost, bucket, objnum)
-		req, _ := http.NewRequest("DELETE", prefix, nil)
-		setSignature(req)
-		if resp, err := httpClient.Do(req); err != nil {
-			log.Fatalf("FATAL: Error deleting object %s: %v", prefix, err)
-		} else if resp != nil && resp.StatusCode == http.StatusServiceUnavailable {
-			atomic.AddInt32(&deleteSlowdownCount, 1)
-			atomic.AddInt32(&deleteCount, -1)
+	// Merge the agents, the phase took as long as the slowest one
+	var total phaseCounters
+	var latency latencyHistogram
+	seconds, threadsTotal := 0.0, 0
+	for _, agent := range agents {
+		r := agent.result
+		total = total.add(r.Counters)
+		latency.merge(r.Latency)
+		var own latencyHistogram
+		own.merge(r.Latency)
+		threadsTotal += r.Threads
+		if r.Seconds > seconds {
+			seconds = r.Seconds
 		}
+		logit(fmt.Sprintf("%s agent %s: time %.1f secs, %s", label, agent.addr, r.Seconds, r.Counters.describe(r.Seconds, &own)))
 	}
-	// Remember last done time
-	deleteFinish = time.Now()
-	// One less thread
-	atomic.AddInt32(&runningThreads, -1)
+	if seconds <= 0 {
+		seconds = 1
+	}
+	logit(fmt.Sprintf("%s time %.1f secs, agents = %d, threads = %d, %s", label, seconds, len(agents), threadsTotal, total.describe(seconds, &latency)))
+	return agentResult{Seconds: seconds, Counters: total, Latency: latency.snapshot(), Threads: threadsTotal}
 }
 
 func main() {
@@ -390,7 +3526,7 @@ func main() {
 	myflag := flag.NewFlagSet("myflag", flag.ExitOnError)
 	myflag.StringVar(&accessKey, "a", "", "Access key")
 	myflag.StringVar(&secretKey, "s", "", "Secret key")
-	myflag.StringVar(&urlHost, "u", "http://s3.wasabisys.com", "URL for host with method prefix")
+	myflag.StringVar(&urlHost, "u", "http://s3.wasabisys.com", "URL for host with method prefix, or a comma separated list of gateway nodes")
 	myflag.StringVar(&bucket, "b", "wasabi-benchmark-bucket", "Bucket for testing")
 	myflag.StringVar(&region, "r", "us-east-1", "Region for testing")
 	myflag.IntVar(&durationSecs, "d", 60, "Duration of each test in seconds")
@@ -398,10 +3534,85 @@ func main() {
 	myflag.IntVar(&loops, "l", 1, "Number of times to repeat test")
 	var sizeArg string
 	myflag.StringVar(&sizeArg, "z", "1M", "Size of objects in bytes with postfix K, M, and G")
-	if err := myflag.Parse(os.Args[1:]); err != nil {
+	var phasesArg, copyPartArg string
+	myflag.StringVar(&phasesArg, "phases", "put,get,head,list2,listver,delete", "Comma separated test phases to run, out of put, get, head, copy, list2, listver, delete and multidelete")
+	myflag.IntVar(&deleteBatch, "batch", 1000, "Number of keys per DeleteObjects request of the multidelete phase, 1 to 1000")
+	myflag.StringVar(&copyBucket, "copy-bucket", "", "Destination bucket of the copy phase, defaults to the -b bucket")
+	myflag.StringVar(&copyPartArg, "copy-part-size", "0", "Copy with UploadPartCopy in parts of this size with postfix K, M, and G, 0 for CopyObject")
+	myflag.StringVar(&keyDist, "dist", "uniform", "Key distribution for GET and HEAD: uniform, zipf, hotspot, sequential or latest")
+	myflag.Float64Var(&zipfSkew, "zipf", 0.99, "Skew of the zipf and latest key distributions, between 0 and 1")
+	myflag.StringVar(&hotspotArg, "hotspot", "20:80", "Hotspot key distribution as KEYS%:OPS%, the first KEYS% of the objects get OPS% of the reads")
+	myflag.StringVar(&keyScheme, "key", "sequential", "Object key scheme: sequential, random, hashed, reversed, date, tree or template")
+	myflag.StringVar(&keyTemplate, "key-template", "", "Object key template for -key template, eg. data/{hash:2}/{n:08}")
+	myflag.IntVar(&keyPrefixLen, "key-prefix", 4, "Number of hex digits of the random and hashed key prefixes")
+	myflag.IntVar(&keyLevels, "key-levels", 2, "Directory levels of the tree key scheme")
+	myflag.IntVar(&keyFanout, "key-fanout", 16, "Directories per level of the tree key scheme")
+	myflag.DurationVar(&keyDateStep, "key-date-step", time.Second, "Time between consecutive objects of the date key scheme")
+	myflag.IntVar(&versionDepth, "versions", 0, "Versioned mode instead of the test loop, enable versioning and grow version chains to this depth")
+	myflag.IntVar(&versionKeys, "version-keys", 100, "Versioned mode number of keys that get overwritten")
+	myflag.BoolVar(&consistency, "consistency", false, "Consistency mode instead of the test loop, PUT then immediately GET, HEAD and LIST, overwrite and DELETE, recording anomalies")
+	myflag.DurationVar(&consistencyWait, "consistency-wait", 30*time.Second, "Consistency mode longest wait for an anomaly to converge")
+	myflag.DurationVar(&consistencyPoll, "consistency-poll", 100*time.Millisecond, "Consistency mode time between reads while waiting for convergence")
+	myflag.StringVar(&rampOp, "ramp", "", "Ramp mode instead of the test loop, step up load for put or get")
+	myflag.StringVar(&rampBy, "ramp-by", "threads", "Ramp mode step unit, threads or rate (operations/sec with -t threads)")
+	myflag.IntVar(&rampStart, "ramp-start", 1, "Ramp mode threads or rate of the first step")
+	myflag.IntVar(&rampStep, "ramp-step", 1, "Ramp mode threads or rate added on each step")
+	myflag.IntVar(&rampSteps, "ramp-steps", 8, "Ramp mode number of steps")
+	myflag.IntVar(&rampHoldSecs, "ramp-hold", 30, "Ramp mode duration of each step in seconds")
+	myflag.Float64Var(&rampThroughputGain, "ramp-gain", 0.05, "Ramp mode knee when throughput grows less than this fraction")
+	myflag.Float64Var(&rampLatencyGrowth, "ramp-latency", 0.5, "Ramp mode knee when average latency grows more than this fraction")
+	myflag.StringVar(&balanceMode, "lb", "rr", "Balancing over the -u endpoints: rr (round-robin), least (least outstanding) or hash (by key)")
+	var monitorClient bool
+	var prepareObjects int
+	var prepareTotal string
+	myflag.IntVar(&prepareObjects, "objects", 0, "Number of objects the prepare command uploads into the bucket")
+	myflag.StringVar(&prepareTotal, "total", "0", "Bytes the prepare command uploads into the bucket with postfix K, M, and G, instead of -objects")
+	myflag.BoolVar(&useDataset, "dataset", false, "Run the get, head, copy and listing phases against the objects of the prepare command instead of uploading them")
+	myflag.StringVar(&agentListen, "listen", "127.0.0.1:7070", "Address the agent command listens on for the coordinator, eg. :7070 for all interfaces")
+	myflag.StringVar(&agentToken, "token", os.Getenv("S3_BENCHMARK_TOKEN"), "Shared secret of the coordinator and its agents, defaults to $S3_BENCHMARK_TOKEN")
+	myflag.StringVar(&agentsArg, "agents", "", "Comma separated host:port of agents to coordinate, the phases run on all of them at the same time")
+	myflag.BoolVar(&monitorClient, "monitor", false, "Report the CPU, GC, heap, goroutines and network throughput of the client after each phase")
+	myflag.BoolVar(&traceRequests, "trace", false, "Report where request time goes per operation: DNS, connect, TLS, request write, time to first byte, body transfer and connection reuse")
+	var readBufferArg, writeBufferArg string
+	var uploadRateArg, downloadRateArg, threadUploadRateArg, threadDownloadRateArg string
+	myflag.StringVar(&uploadRateArg, "upload-limit", "0", "Upload bandwidth of all threads together in bytes/sec with postfix K, M, and G, 0 for unlimited")
+	myflag.StringVar(&downloadRateArg, "download-limit", "0", "Download bandwidth of all threads together in bytes/sec with postfix K, M, and G, 0 for unlimited")
+	myflag.StringVar(&threadUploadRateArg, "thread-upload-limit", "0", "Upload bandwidth of each thread in bytes/sec with postfix K, M, and G, 0 for unlimited")
+	myflag.StringVar(&threadDownloadRateArg, "thread-download-limit", "0", "Download bandwidth of each thread in bytes/sec with postfix K, M, and G, 0 for unlimited")
+	myflag.BoolVar(&keepAlive, "keepalive", true, "Keep connections open between requests, -keepalive=false for a new connection per request")
+	myflag.IntVar(&maxConns, "max-conns", 0, "Maximum connections per host, requests wait for a free one, 0 for unlimited")
+	myflag.IntVar(&maxIdleConns, "max-idle", 4096, "Maximum idle connections kept open per host")
+	myflag.DurationVar(&idleTimeout, "idle-timeout", time.Minute, "Close idle connections after this time")
+	myflag.StringVar(&connPool, "pool", "shared", "Connection pool: shared by all threads, or thread for a dedicated transport per thread")
+	myflag.BoolVar(&useHTTP2, "http2", false, "Negotiate HTTP/2 with https endpoints that support it")
+	myflag.BoolVar(&compression, "compression", true, "Ask for gzip responses, -compression=false to disable")
+	myflag.StringVar(&readBufferArg, "read-buffer", "4K", "Read buffer size of each connection with postfix K, M, and G")
+	myflag.StringVar(&writeBufferArg, "write-buffer", "4K", "Write buffer size of each connection with postfix K, M, and G")
+	myflag.BoolVar(&tlsVerify, "tls-verify", false, "Verify the server certificate against the system CAs, implied by -tls-ca")
+	myflag.StringVar(&tlsCA, "tls-ca", "", "PEM file of the CA certificates to verify the server certificate against")
+	myflag.StringVar(&tlsCert, "tls-cert", "", "PEM file of the client certificate for mutual TLS")
+	myflag.StringVar(&tlsKey, "tls-key", "", "PEM file of the key of -tls-cert")
+	myflag.StringVar(&tlsMinVersion, "tls-min", "", "Minimum TLS version: 1.0, 1.1, 1.2 or 1.3")
+	myflag.StringVar(&tlsCiphers, "tls-ciphers", "", "Comma separated TLS 1.0-1.2 cipher suites, eg. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")
+	myflag.BoolVar(&tlsTickets, "tls-tickets", true, "Resume TLS sessions with session tickets, -tls-tickets=false for a full handshake on every connection")
+	myflag.BoolVar(&resolveEndpoints, "resolve", false, "Resolve the -u host names and use every A/AAAA record as an endpoint")
+	args, command := os.Args[1:], ""
+	if len(args) > 0 && (args[0] == "conformance" || args[0] == "agent" || args[0] == "prepare") {
+		args, command = args[1:], args[0]
+	}
+	if err := myflag.Parse(args); err != nil {
 		os.Exit(1)
 	}
 
+	// The coordinator only schedules, the agents have the credentials and the rest of the settings
+	if (agentsArg != "" || command == "agent") && agentToken == "" {
+		log.Fatal("Missing argument -token, the coordinator and its agents need a shared secret.")
+	}
+	if agentsArg != "" {
+		runCoordinator(strings.Split(agentsArg, ","), phasesArg)
+		return
+	}
+
 	// Check the arguments
 	if accessKey == "" {
 		log.Fatal("Missing argument -a for access key.")
@@ -409,14 +3620,169 @@ func main() {
 	if secretKey == "" {
 		log.Fatal("Missing argument -s for secret key.")
 	}
+
+	// Transport and TLS settings go into the transport before anything connects
 	var err error
+	if tlsConfig, err = newTLSConfig(); err != nil {
+		log.Fatalf("Invalid -tls argument: %v", err)
+	}
+	if readBuffer, err = bytefmt.ToBytes(readBufferArg); err != nil {
+		log.Fatalf("Invalid -read-buffer argument: %v", err)
+	}
+	if writeBuffer, err = bytefmt.ToBytes(writeBufferArg); err != nil {
+		log.Fatalf("Invalid -write-buffer argument: %v", err)
+	}
+	if connPool != "shared" && connPool != "thread" {
+		log.Fatalf("Invalid -pool argument %q, expecting shared or thread", connPool)
+	}
+	transport := newTransport()
+	HTTPTransport, httpClient.Transport = transport, transport
+	for _, limit := range []struct {
+		flag string
+		arg  string
+		rate *uint64
+	}{
+		{"upload-limit", uploadRateArg, &uploadRate},
+		{"download-limit", downloadRateArg, &downloadRate},
+		{"thread-upload-limit", threadUploadRateArg, &threadUploadRate},
+		{"thread-download-limit", threadDownloadRateArg, &threadDownloadRate},
+	} {
+		if limit.arg == "0" {
+			continue
+		}
+		if *limit.rate, err = bytefmt.ToBytes(limit.arg); err != nil {
+			log.Fatalf("Invalid -%s argument: %v", limit.flag, err)
+		}
+	}
+	uploadLimit, downloadLimit = newThrottle(uploadRate), newThrottle(downloadRate)
+	logit(fmt.Sprintf("Transport: pool=%s, keepalive=%v, http2=%v, max-conns=%d, max-idle=%d, idle-timeout=%s, compression=%v, buffers=%s/%s",
+		connPool, keepAlive, useHTTP2, maxConns, maxIdleConns, idleTimeout, compression, readBufferArg, writeBufferArg))
+	if uploadRate+downloadRate+threadUploadRate+threadDownloadRate > 0 {
+		logit(fmt.Sprintf("Bandwidth limits: upload = %s/sec, download = %s/sec, per thread upload = %s/sec, download = %s/sec",
+			uploadRateArg, downloadRateArg, threadUploadRateArg, threadDownloadRateArg))
+	}
+	if monitorClient {
+		monitor = startClientMonitor()
+	}
+
+	// Several endpoints share the requests through one balancing transport
+	endpoints := strings.Split(urlHost, ",")
+	urlHost = endpoints[0]
+	if len(endpoints) > 1 || resolveEndpoints {
+		if balancer, err = newEndpointBalancer(endpoints, resolveEndpoints, balanceMode, transport); err != nil {
+			log.Fatalf("Invalid -u argument: %v", err)
+		}
+		HTTPTransport = balancer
+		httpClient.Transport = balancer
+		names := []string{}
+		for _, e := range balancer.endpoints {
+			names = append(names, e.name)
+		}
+		logit(fmt.Sprintf("Endpoints: lb=%s, %s", balanceMode, strings.Join(names, ", ")))
+	}
+
+	// Conformance command checks behavior instead of measuring it
+	if command == "conformance" {
+		if runConformance(getS3Client(), bucket) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
 	if objectSize, err = bytefmt.ToBytes(sizeArg); err != nil {
 		log.Fatalf("Invalid -z argument for object size: %v", err)
 	}
+	phases = map[string]bool{}
+	for _, phase := range strings.Split(phasesArg, ",") {
+		switch phase {
+		case "put", "get", "head", "copy", "list2", "listver", "delete", "multidelete":
+			phases[phase] = true
+		default:
+			log.Fatalf("Invalid -phases argument, unknown phase %q", phase)
+		}
+	}
+	if useDataset {
+		// Agents get their phases from the coordinator and refuse these there
+		if command != "agent" && (phases["put"] || phases["delete"] || phases["multidelete"]) {
+			log.Fatal("With -dataset only the get, head, copy, list2 and listver phases run, the others would change the dataset.")
+		}
+		if rampOp != "" || versionDepth > 0 || consistency {
+			log.Fatal("With -dataset only the test phases run, ramp, versioned and consistency mode would change the dataset.")
+		}
+	} else if !phases["put"] && (phases["get"] || phases["head"] || phases["copy"]) {
+		log.Fatal("The get, head and copy phases need the put phase to upload objects, or -dataset for prepared ones.")
+	}
+	if phases["delete"] && phases["multidelete"] {
+		log.Fatal("The delete and multidelete phases both delete the uploaded objects, choose one.")
+	}
+	if deleteBatch < 1 || deleteBatch > 1000 {
+		log.Fatal("Invalid -batch argument, DeleteObjects takes 1 to 1000 keys.")
+	}
+	if copyBucket == "" {
+		copyBucket = bucket
+	}
+	if copyPartArg != "0" {
+		if copyPartSize, err = bytefmt.ToBytes(copyPartArg); err != nil {
+			log.Fatalf("Invalid -copy-part-size argument: %v", err)
+		}
+		if copyPartSize < 5*bytefmt.MEGABYTE {
+			log.Fatal("Invalid -copy-part-size argument, UploadPartCopy parts must be at least 5M.")
+		}
+	}
+	// A prepared dataset brings its own object size and key naming
+	var dataset *datasetMarker
+	keySalt, keyEpoch = rand.Uint64(), time.Now().UTC()
+	if command == "prepare" {
+		createBucket(bucket, true)
+		if dataset = readDataset(getS3Client()); dataset == nil {
+			dataset = &datasetMarker{datasetLayout: currentLayout(), Salt: keySalt, Epoch: keyEpoch}
+		} else if dataset.datasetLayout != currentLayout() {
+			log.Fatalf("Bucket %s holds a dataset of %sB objects with -key %s, prepare it with the same -z and -key flags or empty it first",
+				bucket, bytefmt.ByteSize(dataset.Size), dataset.Key)
+		}
+		dataset.useLayout()
+	} else if useDataset {
+		if dataset = readDataset(getS3Client()); dataset == nil || dataset.Objects == 0 {
+			log.Fatalf("No prepared objects in bucket %s, run the prepare command first", bucket)
+		}
+		dataset.useLayout()
+		datasetObjects, uploadCount = dataset.Objects, dataset.Objects
+		sizeArg = bytefmt.ByteSize(objectSize)
+		logit(fmt.Sprintf("Dataset: %d objects of %s in bucket %s, key=%s", dataset.Objects, sizeArg, bucket, keyScheme))
+	}
+	if keyScheme == "template" && keyTemplate == "" {
+		log.Fatal("Missing argument -key-template for -key template.")
+	}
+	if objectKey, err = newKeyNamer(keyScheme, keyTemplate); err != nil {
+		log.Fatalf("Invalid -key argument: %v", err)
+	}
+	if getPicker, err = newKeyPicker(keyDist, zipfSkew, hotspotArg); err != nil {
+		log.Fatalf("Invalid -dist argument: %v", err)
+	}
+	if versionDepth > 0 && versionKeys < 1 {
+		log.Fatal("Versioned mode needs -version-keys of at least 1")
+	}
+	if consistency && objectSize < 16 {
+		log.Fatal("Consistency mode needs -z of at least 16 bytes to tell versions apart")
+	}
+	if consistencyPoll <= 0 {
+		log.Fatal("Consistency mode needs a positive -consistency-poll")
+	}
+	if rampOp != "" && rampOp != "put" && rampOp != "get" {
+		log.Fatalf("Invalid -ramp argument %q, expecting put or get", rampOp)
+	}
+	if rampBy != "threads" && rampBy != "rate" {
+		log.Fatalf("Invalid -ramp-by argument %q, expecting threads or rate", rampBy)
+	}
+	if rampSteps < 1 || rampStart < 1 || rampHoldSecs < 1 {
+		log.Fatal("Ramp mode needs -ramp-steps, -ramp-start and -ramp-hold of at least 1")
+	}
+	if rampStep < 0 || rampStart+(rampSteps-1)*rampStep < 1 {
+		log.Fatal("Ramp mode needs a -ramp-step of at least 0, every step needs at least 1 thread or operation/sec")
+	}
 
 	// Echo the parameters
-	logit(fmt.Sprintf("Parameters: url=%s, bucket=%s, region=%s, duration=%d, threads=%d, loops=%d, size=%s",
-		urlHost, bucket, region, durationSecs, threads, loops, sizeArg))
+	logit(fmt.Sprintf("Parameters: url=%s, bucket=%s, region=%s, duration=%d, threads=%d, loops=%d, size=%s, dist=%s, key=%s, phases=%s",
+		urlHost, bucket, region, durationSecs, threads, loops, sizeArg, keyDist, keyScheme, phasesArg))
 
 	// Initialize data for the bucket
 	objectData = make([]byte, objectSize)
@@ -425,23 +3791,103 @@ func main() {
 	hasher.Write(objectData)
 	objectDataMd5 = base64.StdEncoding.EncodeToString(hasher.Sum(nil))
 
-	// Create the bucket and delete all the objects
-	createBucket(true)
-	deleteAllObjects()
+	// Prepare only uploads
+	if command == "prepare" {
+		if prepareObjects > math.MaxInt32 {
+			log.Fatalf("Invalid -objects argument, at most %d objects.", math.MaxInt32)
+		}
+		target := int32(prepareObjects)
+		if prepareTotal != "0" {
+			total, err := bytefmt.ToBytes(prepareTotal)
+			if err != nil {
+				log.Fatalf("Invalid -total argument: %v", err)
+			}
+			objects := (total + objectSize - 1) / objectSize
+			if objects > math.MaxInt32 {
+				log.Fatalf("Invalid -total argument, %s of %sB objects are %d objects, more than %d, use a larger -z.",
+					prepareTotal, bytefmt.ByteSize(objectSize), objects, math.MaxInt32)
+			}
+			target = int32(objects)
+		}
+		if target < 1 {
+			log.Fatal("The prepare command needs -objects or -total.")
+		}
+		runPrepare(getS3Client(), dataset, target)
+		reportPhase("Prepare:")
+		return
+	}
+
+	// Agents set up the bucket when the coordinator tells them to
+	if command == "agent" {
+		if rampOp != "" || versionDepth > 0 || consistency {
+			log.Fatal("Agents run the test phases only, not ramp, versioned or consistency mode.")
+		}
+		runAgent()
+		return
+	}
+
+	// Create the bucket and delete all the objects, unless they are the dataset to test
+	if !useDataset {
+		createBucket(bucket, true)
+		deleteAllObjects(getS3Client(), bucket)
+	}
+	if phases["copy"] && copyBucket != bucket {
+		createBucket(copyBucket, true)
+		deleteAllObjects(getS3Client(), copyBucket)
+	}
+	reportPhase("Setup:")
+
+	// Ramp mode replaces the regular test loop
+	if rampOp != "" {
+		logit(fmt.Sprintf("Ramp: op=%s, by=%s, start=%d, step=%d, steps=%d, hold=%d",
+			rampOp, rampBy, rampStart, rampStep, rampSteps, rampHoldSecs))
+		runRamp()
+		reportPhase("Ramp:")
+		return
+	}
+
+	// Versioned mode replaces the regular test loop too
+	if versionDepth > 0 {
+		logit(fmt.Sprintf("Versions: depth=%d, keys=%d", versionDepth, versionKeys))
+		runVersioned()
+		reportPhase("Versions:")
+		return
+	}
+
+	// Consistency mode as well
+	if consistency {
+		runConsistency()
+		reportPhase("Consistency:")
+		return
+	}
 
 	// Loop running the tests
 	for loop := 1; loop <= loops; loop++ {
 
 		// reset counters
-		uploadCount = 0
+		uploadCount = datasetObjects
 		uploadSlowdownCount = 0
 		downloadCount = 0
 		downloadSlowdownCount = 0
+		downloadErrorCount = 0
+		headCount = 0
+		headSlowdownCount = 0
+		headErrorCount = 0
+		headLatency.reset()
+		copyCount = 0
+		copySlowdownCount = 0
+		copyErrorCount = 0
+		copyLatency.reset()
 		deleteCount = 0
 		deleteSlowdownCount = 0
+		multiDeleteCount = 0
+		multiDeleteRequests = 0
+		multiDeleteSlowdownCount = 0
+		multiDeleteKeyErrors = 0
+		multiDeleteLatency.reset()
 
 		// Run the upload case
-		{
+		if phases["put"] {
 			runningThreads = int32(threads)
 			startTime := time.Now()
 			endTime = startTime.Add(time.Second * time.Duration(durationSecs))
@@ -457,11 +3903,12 @@ func main() {
 
 			bps := float64(uint64(uploadCount)*objectSize) / upload_time
 			logit(fmt.Sprintf("Loop %d: PUT time %.1f secs, objects = %d, speed = %sB/sec, %.1f operations/sec. Slowdowns = %d",
-				loop, upload_time, uploadCount, bytefmt.ByteSize(uint64(bps)), float64(uploadCount)/upload_time, uploadSlowdownCount))
+				loop, upload_time, uploadCount, byteRate(bps), float64(uploadCount)/upload_time, uploadSlowdownCount))
+			reportPhase(fmt.Sprintf("Loop %d: PUT", loop))
 		}
 
 		// Run the download case
-		{
+		if phases["get"] {
 			runningThreads = int32(threads)
 			startTime := time.Now()
 			endTime = startTime.Add(time.Second * time.Duration(durationSecs))
@@ -476,12 +3923,55 @@ func main() {
 			downloadTime := downloadFinish.Sub(startTime).Seconds()
 			bps := float64(uint64(downloadCount)*objectSize) / downloadTime
 
-			logit(fmt.Sprintf("Loop %d: GET time %.1f secs, objects = %d, speed = %sB/sec, %.1f operations/sec. Slowdowns = %d",
-				loop, downloadTime, downloadCount, bytefmt.ByteSize(uint64(bps)), float64(downloadCount)/downloadTime, downloadSlowdownCount))
+			logit(fmt.Sprintf("Loop %d: GET time %.1f secs, objects = %d, speed = %sB/sec, %.1f operations/sec. Slowdowns = %d, Errors = %d",
+				loop, downloadTime, downloadCount, byteRate(bps), float64(downloadCount)/downloadTime, downloadSlowdownCount, downloadErrorCount))
+			reportPhase(fmt.Sprintf("Loop %d: GET", loop))
+		}
+
+		// Run the head case
+		if phases["head"] {
+			runningThreads = int32(threads)
+			startTime := time.Now()
+			endTime = startTime.Add(time.Second * time.Duration(durationSecs))
+			for n := 1; n <= threads; n++ {
+				go runHead(n)
+			}
+
+			// Wait for it to finish
+			for atomic.LoadInt32(&runningThreads) > 0 {
+				time.Sleep(time.Millisecond)
+			}
+			headTime := headFinish.Sub(startTime).Seconds()
+
+			logit(fmt.Sprintf("Loop %d: HEAD time %.1f secs, objects = %d, %.1f operations/sec, latency avg = %s, p99 = %s. Slowdowns = %d, Errors = %d",
+				loop, headTime, headCount, float64(headCount)/headTime, headLatency.mean(), headLatency.percentile(99), headSlowdownCount, headErrorCount))
+			reportPhase(fmt.Sprintf("Loop %d: HEAD", loop))
+		}
+
+		// Run the copy case
+		if phases["copy"] {
+			runningThreads = int32(threads)
+			startTime := time.Now()
+			endTime = startTime.Add(time.Second * time.Duration(durationSecs))
+			for n := 1; n <= threads; n++ {
+				go runCopy(n)
+			}
+
+			// Wait for it to finish
+			for atomic.LoadInt32(&runningThreads) > 0 {
+				time.Sleep(time.Millisecond)
+			}
+			copyTime := copyFinish.Sub(startTime).Seconds()
+			bps := float64(uint64(copyCount)*objectSize) / copyTime
+
+			logit(fmt.Sprintf("Loop %d: COPY time %.1f secs, objects = %d, speed = %sB/sec, %.1f operations/sec, latency avg = %s, p99 = %s. Slowdowns = %d, Errors = %d",
+				loop, copyTime, copyCount, byteRate(bps), float64(copyCount)/copyTime, copyLatency.mean(), copyLatency.percentile(99), copySlowdownCount, copyErrorCount))
+			reportPhase(fmt.Sprintf("Loop %d: COPY", loop))
+			deleteCopies()
 		}
 
 		// Run the list objects v2 case
-		{
+		if phases["list2"] {
 			runningThreads = int32(threads)
 			startTime := time.Now()
 			endTime = startTime.Add(time.Second * time.Duration(durationSecs))
@@ -498,10 +3988,11 @@ func main() {
 
 			logit(fmt.Sprintf("Loop %d: LIST2 time %.1f secs, ops = %d, speed = %.1f rows/sec, %.1f operations/sec. Slowdowns = %d",
 				loop, listingTime, listObjCount, rowsPerSec, opsPerSec, listObjSlowdownCount))
+			reportPhase(fmt.Sprintf("Loop %d: LIST2", loop))
 		}
 
 		// Run the list object versions case
-		{
+		if phases["listver"] {
 			runningThreads = int32(threads)
 			startTime := time.Now()
 			endTime = startTime.Add(time.Second * time.Duration(durationSecs))
@@ -518,10 +4009,11 @@ func main() {
 
 			logit(fmt.Sprintf("Loop %d: LISTver time %.1f secs, ops = %d, speed = %.1f rows/sec, %.1f operations/sec. Slowdowns = %d",
 				loop, listingTime, listVerCount, rowsPerSec, opsPerSec, listVerSlowdownCount))
+			reportPhase(fmt.Sprintf("Loop %d: LISTver", loop))
 		}
 
 		// Run the delete case
-		{
+		if phases["delete"] {
 			runningThreads = int32(threads)
 			startTime := time.Now()
 			endTime = startTime.Add(time.Second * time.Duration(durationSecs))
@@ -537,6 +4029,29 @@ func main() {
 
 			logit(fmt.Sprintf("Loop %d: DELETE time %.1f secs, %.1f deletes/sec. Slowdowns = %d",
 				loop, deleteTime, float64(uploadCount)/deleteTime, deleteSlowdownCount))
+			reportPhase(fmt.Sprintf("Loop %d: DELETE", loop))
+		}
+
+		// Run the multi object delete case
+		if phases["multidelete"] {
+			runningThreads = int32(threads)
+			startTime := time.Now()
+			endTime = startTime.Add(time.Second * time.Duration(durationSecs))
+			for n := 1; n <= threads; n++ {
+				go runMultiDelete(n)
+			}
+
+			// Wait for it to finish
+			for atomic.LoadInt32(&runningThreads) > 0 {
+				time.Sleep(time.Millisecond)
+			}
+			deleteTime := multiDeleteFinish.Sub(startTime).Seconds()
+			deleted := uploadCount - multiDeleteKeyErrors
+
+			logit(fmt.Sprintf("Loop %d: MULTIDELETE time %.1f secs, batch = %d, requests = %d, %.1f deletes/sec, %.1f requests/sec, latency avg = %s, p99 = %s. Slowdowns = %d, Key errors = %d",
+				loop, deleteTime, deleteBatch, multiDeleteRequests, float64(deleted)/deleteTime, float64(multiDeleteRequests)/deleteTime,
+				multiDeleteLatency.mean(), multiDeleteLatency.percentile(99), multiDeleteSlowdownCount, multiDeleteKeyErrors))
+			reportPhase(fmt.Sprintf("Loop %d: MULTIDELETE", loop))
 		}
 	}
 
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+)
+
+// startFakeS3 -- in-process S3 endpoint, the globals of getS3Client point at it
+func startFakeS3(t *testing.T) *httptest.Server {
+	faker := gofakes3.New(s3mem.New()).Server()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// gofakes3 lists unversioned objects as version "null" but can't delete them by it
+		if _, ok := r.URL.Query()["delete"]; ok && r.Method == "POST" {
+			body, _ := ioutil.ReadAll(r.Body)
+			body = bytes.ReplaceAll(body, []byte("<VersionId>null</VersionId>"), nil)
+			r.Body, r.ContentLength = io.NopCloser(bytes.NewReader(body)), int64(len(body))
+		}
+		faker.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	urlHost, accessKey, secretKey, region = server.URL, "test", "test", "us-east-1"
+	return server
+}
+
+// fakeS3Gaps -- conformance checks gofakes3 is known to fail
+var fakeS3Gaps = map[string]bool{
+	"key and versionId markers page through every version once": true,
+	"ETag is md5 of the part md5s and the part count":           true,
+	"parts out of order is 400 InvalidPartOrder":                true,
+	"part below 5MB that is not the last is 400 EntityTooSmall": true,
+	"GET If-Match other ETag is 412 PreconditionFailed":         true,
+	"GET If-Modified-Since last modified is 304":                true,
+	"GET If-Unmodified-Since before last modified is 412":       true,
+	"CopyObject copy-source-if-match other ETag is 412":         true,
+}
+
+func TestConformance(t *testing.T) {
+	startFakeS3(t)
+	client := getS3Client()
+	for _, bucket := range []string{"conformance-checks", "conformance-test"} {
+		if _, err := client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(bucket)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each check on its own, so a new gap shows up as the check it belongs to
+	c := &conformance{client: client, bucket: "conformance-checks", versionBucket: "conformance-checks-versioned"}
+	for _, check := range conformanceChecks {
+		if err := check.run(c); (err != nil) != fakeS3Gaps[check.name] {
+			t.Errorf("%s %s: %v, known gap %v", check.group, check.name, err, fakeS3Gaps[check.name])
+		}
+	}
+
+	const bucket = "conformance-test"
+	if _, err := client.PutObject(&s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String("keep"), Body: strings.NewReader("keep")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if failed := runConformance(client, bucket); failed != len(fakeS3Gaps) {
+		t.Errorf("runConformance failed %d checks, expected %d", failed, len(fakeS3Gaps))
+	}
+
+	// Only the keys of the checks are gone, and the versioned bucket they created
+	list, err := client.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: aws.String(bucket)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Contents) != 1 || aws.StringValue(list.Contents[0].Key) != "keep" {
+		var keys []string
+		for _, obj := range list.Contents {
+			keys = append(keys, aws.StringValue(obj.Key))
+		}
+		t.Errorf("expected only keep left in %s, got %v", bucket, keys)
+	}
+	buckets, err := client.ListBuckets(&s3.ListBucketsInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range buckets.Buckets {
+		if aws.StringValue(b.Name) == bucket+"-versioned" {
+			t.Errorf("bucket %s-versioned left behind", bucket)
+		}
+	}
+}
+
+func TestInvalidBucketNameCleanup(t *testing.T) {
+	// A lenient server that creates any bucket it is asked for
+	var deleted bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" && r.URL.Path == "/Invalid_Bucket_Name" {
+			deleted = true
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+	urlHost, accessKey, secretKey, region = server.URL, "test", "test", "us-east-1"
+
+	c := &conformance{client: getS3Client(), bucket: "conformance-checks"}
+	for _, check := range conformanceChecks {
+		if check.name != "CreateBucket with invalid name is 400 InvalidBucketName" {
+			continue
+		}
+		if err := check.run(c); err == nil {
+			t.Errorf("%s passed against a lenient server", check.name)
+		}
+		if !deleted {
+			t.Errorf("%s left Invalid_Bucket_Name behind", check.name)
+		}
+		return
+	}
+	t.Fatal("no CreateBucket with invalid name check")
+}
+
+func TestCoordinatedPhase(t *testing.T) {
+	startFakeS3(t)
+	bucket, copyBucket, objectSize, threads, durationSecs, agentToken = "agents", "agents", 1024, 2, 1, "secret"
+	objectData = make([]byte, objectSize)
+	sum := md5.Sum(objectData)
+	objectDataMd5 = base64.StdEncoding.EncodeToString(sum[:])
+	var err error
+	if objectKey, err = newKeyNamer("sequential", ""); err != nil {
+		t.Fatal(err)
+	}
+	if getPicker, err = newKeyPicker("uniform", 0.99, "20:80"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Agents in one process run their phases one after another, the merge is the same
+	var agents []*coordinatedAgent
+	for n := 0; n < 3; n++ {
+		server := httptest.NewServer(agentMux())
+		t.Cleanup(server.Close)
+		agents = append(agents, &coordinatedAgent{addr: server.Listener.Addr().String()})
+	}
+	for _, token := range []string{"", "wrong"} {
+		req, _ := http.NewRequest(http.MethodPost, "http://"+agents[0].addr+"/clock", nil)
+		req.Header.Set(agentTokenHeader, token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("agent answered token %q with %s", token, resp.Status)
+		}
+	}
+	for i, agent := range agents {
+		resp, err := agentCall(agent.addr, "/setup", agentSetup{Index: i + 1, Agents: len(agents)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	for _, phase := range []string{"put", "get"} {
+		merged := runCoordinatedPhase(agents, 1, phase)
+		var total phaseCounters
+		var latency latencyHistogram
+		threadsTotal := 0
+		for _, agent := range agents {
+			if agent.result.Counters.Ops == 0 || agent.result.Latency.Count != agent.result.Counters.Ops {
+				t.Errorf("%s agent %s: %d ops, %d latencies", phase, agent.addr, agent.result.Counters.Ops, agent.result.Latency.Count)
+			}
+			total = total.add(agent.result.Counters)
+			latency.merge(agent.result.Latency)
+			threadsTotal += agent.result.Threads
+		}
+		if merged.Counters != total || merged.Counters.Bytes != merged.Counters.Ops*int64(objectSize) {
+			t.Errorf("%s merged counters %+v, agents %+v", phase, merged.Counters, total)
+		}
+		if merged.Latency.Count != total.Ops || merged.Latency.SumNs != latency.snapshot().SumNs {
+			t.Errorf("%s merged latency %d requests %dns, agents %d requests %dns", phase, merged.Latency.Count, merged.Latency.SumNs, total.Ops, latency.snapshot().SumNs)
+		}
+		for n, count := range latency.snapshot().Buckets {
+			if n >= len(merged.Latency.Buckets) || merged.Latency.Buckets[n] != count {
+				t.Errorf("%s merged latency buckets %v, agents %v", phase, merged.Latency.Buckets, latency.snapshot().Buckets)
+				break
+			}
+		}
+		if merged.Threads != threadsTotal || merged.Threads != len(agents)*threads {
+			t.Errorf("%s merged threads %d, expected %d", phase, merged.Threads, len(agents)*threads)
+		}
+	}
+}
+
+func TestDeleteCopiesKeepsDataset(t *testing.T) {
+	startFakeS3(t)
+	bucket, copyBucket = "dataset", "dataset"
+	var err error
+	if objectKey, err = newKeyNamer("sequential", ""); err != nil {
+		t.Fatal(err)
+	}
+	client := getS3Client()
+	if _, err := client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(bucket)}); err != nil {
+		t.Fatal(err)
+	}
+	keep := map[string]bool{datasetKey: true}
+	keys := []string{datasetKey}
+	for n := int32(1); n <= 3; n++ {
+		keep[objectKey.key(n)] = true
+		keys = append(keys, objectKey.key(n), copyKey(n))
+	}
+	for _, key := range keys {
+		if _, err := client.PutObject(&s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String(key), Body: strings.NewReader(key)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A copy phase with -dataset copies into the dataset bucket, only the copies go afterwards
+	deleteCopies()
+	list, err := client.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: aws.String(bucket)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, obj := range list.Contents {
+		left = append(left, aws.StringValue(obj.Key))
+	}
+	if len(left) != len(keep) {
+		t.Errorf("expected %d keys left in %s, got %v", len(keep), bucket, left)
+	}
+	for _, key := range left {
+		if !keep[key] {
+			t.Errorf("%s left in %s", key, bucket)
+		}
+	}
+}
@@ -2,17 +2,25 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
+	"crypto/md5"
 	"crypto/sha1"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"io/ioutil"
 	"log"
+	"math"
+	"math/rand"
 	"net"
 	"net/http"
 	"os"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -20,8 +28,10 @@ import (
 	"sync/atomic"
 	"time"
 
+	"code.cloudfoundry.org/bytefmt"
 	"github.com/apoorvam/goterminal"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -107,6 +117,718 @@ func (s *Seed) NextVeeamFiles(maxFolder1, maxFolder2, maxFolder3 uint16) []strin
 	return res
 }
 
+// repository wide owner object, checked before every session
+const veeamOwner = `Owner`
+
+// Veeam/Archive/veeam/Clients/{client}/Backups/{backup}/backup.vbm
+// Veeam/Archive/veeam/Clients/{client}/Backups/{backup}/Storages/{storage}/storage.xml
+// Veeam/Archive/veeam/{backup}/{object}/Checkpoints/{checkpoint}/checkpoint.xml
+func (s *Seed) NextVeeamMetaFiles(maxStorages, maxCheckpoints uint16) (client, backup string, res []string) {
+	client = s.NextUuid()
+	backup = s.NextUuid()
+	object := s.NextUuid()
+	rand1, rand2, _, _ := s.NextUint16s()
+	rand1 = 1 + (rand1 % maxStorages)
+	rand2 = 1 + (rand2 % maxCheckpoints)
+	res = append(res, fmt.Sprintf(`Clients/%s/Backups/%s/backup.vbm`, client, backup))
+	for z := uint16(0); z < rand1; z++ {
+		res = append(res, fmt.Sprintf(`Clients/%s/Backups/%s/Storages/%s/storage.xml`, client, backup, s.NextUuid()))
+	}
+	for z := uint16(0); z < rand2; z++ {
+		res = append(res, fmt.Sprintf(`%s/%s/Checkpoints/%s/checkpoint.xml`, backup, object, s.NextUuid()))
+	}
+	return
+}
+
+// Veeam/Archive/veeam/Clients/{client}/Backups/{backup}/Locks/{lock}.lock
+func (s *Seed) NextVeeamLock(client, backup string) string {
+	return fmt.Sprintf(`Clients/%s/Backups/%s/Locks/%s.lock`, client, backup, s.NextUuid())
+}
+
+// NextHexN is n hex digits, for content hashes longer than 64-bit
+func (s *Seed) NextHexN(n int) string {
+	res := ``
+	for len(res) < n {
+		res += s.NextHex16()
+	}
+	return res[:n]
+}
+
+// NextTime is a deterministic backup timestamp within 3 years since 2022
+func (s *Seed) NextTime() time.Time {
+	base := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	return base.Add(time.Duration(s.NextInt64()%(3*365*24*3600)) * time.Second)
+}
+
+// restic/data/{id[:2]}/{id}, restic/index/{id}, restic/snapshots/{id}, id is sha256 of the content
+// packs first, then the index referencing them, then the snapshot, like `restic backup`
+func (s *Seed) NextResticFiles(maxFolder1, maxFolder2, _ uint16) []string {
+	rand1, rand2, _, _ := s.NextUint16s()
+	packs := int(1+(rand1%maxFolder1)) * int(1+(rand2%maxFolder2))
+	res := make([]string, 0, packs+2)
+	for z := 0; z < packs; z++ {
+		id := s.NextHexN(64)
+		res = append(res, `data/`+id[:2]+`/`+id)
+	}
+	res = append(res, `index/`+s.NextHexN(64))
+	res = append(res, `snapshots/`+s.NextHexN(64))
+	return res
+}
+
+// kopia blob ids: p = content pack, q = metadata pack, xn0_ = index, _log_ = maintenance log,
+// all blobs of one session share the -s{session}-c1 suffix
+func (s *Seed) nextKopiaBlobs(dir string, packs int) []string {
+	session := `-s` + s.NextHex16() + `-c1`
+	res := make([]string, 0, packs+3)
+	for z := 0; z < packs; z++ {
+		res = append(res, dir+`p`+s.NextHexN(32)+session)
+	}
+	res = append(res, dir+`q`+s.NextHexN(32)+session)
+	res = append(res, dir+`xn0_`+s.NextHexN(32)+session)
+	ts := s.NextTime()
+	res = append(res, fmt.Sprintf(`%s_log_%s_%04x_%d_%d_1_%s`, dir, ts.Format(`20060102150405`), s.NextInt64()&0xffff, ts.Unix(), ts.Unix()+60, s.NextHexN(32)))
+	return res
+}
+
+func (s *Seed) NextKopiaFiles(maxFolder1, maxFolder2, _ uint16) []string {
+	rand1, rand2, _, _ := s.NextUint16s()
+	return s.nextKopiaBlobs(``, int(1+(rand1%maxFolder1))*int(1+(rand2%maxFolder2)))
+}
+
+var k8sNamespaces = []string{`default`, `app`, `db`, `monitoring`, `ingress`, `logging`}
+
+// velero/kopia/{namespace}/{blob} pod volume data, then
+// velero/backups/{backup}/{backup}.tar.gz, -logs.gz, velero-backup.json, ...
+func (s *Seed) NextVeleroFiles(maxFolder1, maxFolder2, _ uint16) []string {
+	rand1, rand2, rand3, _ := s.NextUint16s()
+	ns := k8sNamespaces[int(rand3)%len(k8sNamespaces)]
+	res := s.nextKopiaBlobs(`kopia/`+ns+`/`, int(1+(rand1%maxFolder1))*int(1+(rand2%maxFolder2)))
+	backup := `daily-` + s.NextTime().Format(`20060102150405`)
+	dir := `backups/` + backup + `/`
+	for _, suffix := range []string{`.tar.gz`, `-logs.gz`, `-podvolumebackups.json.gz`, `-volumesnapshots.json.gz`, `-resource-list.json.gz`, `-results.gz`} {
+		res = append(res, dir+backup+suffix)
+	}
+	return append(res, dir+`velero-backup.json`)
+}
+
+// k10/{cluster}/migration/{namespace}/kopia/{blob} exported data, then
+// k10/{cluster}/migration/{namespace}/restorepoints/{restorepoint}/manifest.json
+func (s *Seed) NextKastenFiles(maxFolder1, maxFolder2, _ uint16) []string {
+	rand1, rand2, rand3, _ := s.NextUint16s()
+	dir := s.NextUuid() + `/migration/` + k8sNamespaces[int(rand3)%len(k8sNamespaces)] + `/`
+	res := s.nextKopiaBlobs(dir+`kopia/`, int(1+(rand1%maxFolder1))*int(1+(rand2%maxFolder2)))
+	restorePoint := dir + `restorepoints/` + s.NextUuid() + `/`
+	return append(res, restorePoint+`artifacts.json`, restorePoint+`manifest.json`)
+}
+
+// CV_MAGNETIC/V_{volume}/CHUNK_{chunk}/SFILE_CONTAINER_{001..}, CHUNK_META_DATA_{chunk}, CHUNK_META_DATA_{chunk}.idx
+func (s *Seed) NextCommvaultFiles(maxFolder1, maxFolder2, _ uint16) []string {
+	rand1, rand2, _, _ := s.NextUint16s()
+	chunks := 1 + (rand1 % maxFolder1)
+	sfiles := 1 + (rand2 % maxFolder2)
+	volume := fmt.Sprintf(`CV_MAGNETIC/V_%d/`, 100000+s.NextInt64()%900000)
+	res := make([]string, 0, int(chunks)*(int(sfiles)+2))
+	for z := uint16(0); z < chunks; z++ {
+		chunkId := 1000000 + s.NextInt64()%9000000
+		dir := fmt.Sprintf(`%sCHUNK_%d/`, volume, chunkId)
+		for y := uint16(1); y <= sfiles; y++ {
+			res = append(res, fmt.Sprintf(`%sSFILE_CONTAINER_%03d`, dir, y))
+		}
+		res = append(res, fmt.Sprintf(`%sCHUNK_META_DATA_%d`, dir, chunkId))
+		res = append(res, fmt.Sprintf(`%sCHUNK_META_DATA_%d.idx`, dir, chunkId))
+	}
+	return res
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// backup tool patterns
+
+// PatternSize is the size mix of objects which key matches
+type PatternSize struct {
+	Match *regexp.Regexp
+	Size  string
+}
+
+// Pattern is how a backup tool lays out and uses its repository
+type Pattern struct {
+	Prefix string
+	// NextFiles generates the objects of one backup session, in upload order
+	NextFiles func(s *Seed, maxFolder1, maxFolder2, maxFolder3 uint16) []string
+	// Sizes first match wins, used when -z not given
+	Sizes []PatternSize
+	// ListDelimiter empty for flat namespaces
+	ListDelimiter string
+	// ListPrefix is the counter-th prefix to list after writing obj, relative to Prefix
+	ListPrefix func(obj string, counter int) string
+	// Defaults are flags applied before the command line flags
+	Defaults []string
+	// Meta has owner/lock/metadata role (-M)
+	Meta bool
+	// ReadRange is the size of the blobs GET reads out of the packed objects, empty reads whole objects
+	ReadRange string
+	// DeleteBatch expires the oldest objects in DeleteObjects requests of this many keys, 0 deletes one by one
+	DeleteBatch int
+}
+
+// DirPrefix cycles between 1st level folder, parent folder, grandparent folder and root
+func DirPrefix(obj string, counter int) string {
+	switch counter % 4 {
+	case 0:
+		return S.LeftOf(obj, `/`)
+	case 1:
+		return S.LeftOfLast(obj, `/`)
+	case 2:
+		return S.LeftOfLast(S.LeftOfLast(obj, `/`), `/`)
+	}
+	return ``
+}
+
+// KopiaPrefix cycles between blob types, kopia lists by blob id prefix
+func KopiaPrefix(obj string, counter int) string {
+	dir := ``
+	if S.Contains(obj, `/`) {
+		dir = S.LeftOfLast(obj, `/`) + `/`
+	}
+	return dir + []string{`p`, `q`, `xn`, `_log`}[counter%4]
+}
+
+var Patterns = map[string]*Pattern{
+	`veeam`: {
+		Prefix:    veeamPrefix,
+		NextFiles: (*Seed).NextVeeamFiles,
+		Sizes: []PatternSize{
+			// zero byte blocks unless -z given, to stay comparable with older runs
+			{regexp.MustCompile(``), `0`},
+		},
+		ListDelimiter: `/`,
+		ListPrefix:    DirPrefix,
+		Meta:          true,
+	},
+	// restore and check read random packs
+	`restic`: {
+		Prefix:    `restic/`,
+		NextFiles: (*Seed).NextResticFiles,
+		Sizes: []PatternSize{
+			{regexp.MustCompile(`^data/`), `4M-16M`},
+			{regexp.MustCompile(`^index/`), `64K-4M`},
+			{regexp.MustCompile(``), `256B-4K`},
+		},
+		ListDelimiter: `/`,
+		ListPrefix:    DirPrefix,
+		Defaults:      []string{`-k`, `uniform`},
+		// blobs are content defined chunks of 512K to 8M
+		ReadRange: `512K-8M`,
+	},
+	// recent contents are hot, kopia caches older indexes
+	`kopia`: {
+		Prefix:    `kopia/`,
+		NextFiles: (*Seed).NextKopiaFiles,
+		Sizes: []PatternSize{
+			{regexp.MustCompile(`^p`), `10M-21M`},
+			{regexp.MustCompile(`^q`), `64K-2M`},
+			{regexp.MustCompile(`^xn`), `4K-1M`},
+			{regexp.MustCompile(``), `1K-16K`},
+		},
+		ListPrefix: KopiaPrefix,
+		Defaults:   []string{`-k`, `latest`},
+		// contents of the default DYNAMIC-4M-BUZHASH splitter
+		ReadRange: `2M-8M`,
+	},
+	// restores are mostly from the latest backup
+	`velero`: {
+		Prefix:    `velero/`,
+		NextFiles: (*Seed).NextVeleroFiles,
+		Sizes: []PatternSize{
+			{regexp.MustCompile(`/p[0-9a-f]+-s`), `10M-21M`},
+			{regexp.MustCompile(`/q[0-9a-f]+-s`), `64K-2M`},
+			{regexp.MustCompile(`/xn0_`), `4K-1M`},
+			{regexp.MustCompile(`\.tar\.gz$`), `1M-64M`},
+			{regexp.MustCompile(`-logs\.gz$`), `16K-1M`},
+			{regexp.MustCompile(``), `1K-64K`},
+		},
+		ListDelimiter: `/`,
+		ListPrefix:    DirPrefix,
+		Defaults:      []string{`-k`, `latest`},
+		// expired backups are removed as a whole
+		DeleteBatch: 1000,
+	},
+	`kasten`: {
+		Prefix:    `k10/`,
+		NextFiles: (*Seed).NextKastenFiles,
+		Sizes: []PatternSize{
+			{regexp.MustCompile(`/p[0-9a-f]+-s`), `10M-21M`},
+			{regexp.MustCompile(`/q[0-9a-f]+-s`), `64K-2M`},
+			{regexp.MustCompile(`/xn0_`), `4K-1M`},
+			{regexp.MustCompile(``), `1K-64K`},
+		},
+		ListDelimiter: `/`,
+		ListPrefix:    DirPrefix,
+		Defaults:      []string{`-k`, `latest`},
+		// kopia repository
+		ReadRange: `2M-8M`,
+	},
+	// aux copy and restore stream chunks in order
+	`commvault`: {
+		Prefix:    `commvault/`,
+		NextFiles: (*Seed).NextCommvaultFiles,
+		Sizes: []PatternSize{
+			{regexp.MustCompile(`/SFILE_CONTAINER_`), `8M-64M`},
+			{regexp.MustCompile(`\.idx$`), `4K-64K`},
+			{regexp.MustCompile(``), `64K-1M`},
+		},
+		ListDelimiter: `/`,
+		ListPrefix:    DirPrefix,
+		Defaults:      []string{`-k`, `sequential`},
+		// data aging prunes whole chunks
+		DeleteBatch: 1000,
+	},
+}
+
+func PatternNames() []string {
+	names := make([]string, 0, len(Patterns))
+	for name := range Patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// key templates
+// {uuid}/{uuid}[f1]/blocks/{hex16}[f2]/{int}.{hex16}.{hex16|zeros32}.blk[f3]
+// every / is a level, [N], [MIN-MAX] or [f1..f3] is how many of it inside its parent (default 1)
+
+// KeyPart is a literal, or placeholder alternatives picked with equal chance
+type KeyPart struct {
+	Literal string
+	Choices []string
+}
+
+type KeyLevel struct {
+	Parts  []KeyPart
+	FanMin int
+	FanMax int
+	FanArg int // 1..3 = 1 to -f1..-f3, overrides FanMin/FanMax
+}
+
+type KeyTemplate struct {
+	Levels []KeyLevel
+}
+
+func validPlaceholder(name string) bool {
+	switch {
+	case name == `uuid`, name == `int`, name == `seq`, name == `time`, name == `hex`:
+		return true
+	case S.StartsWith(name, `time:`):
+		return true
+	}
+	for _, prefix := range []string{`hex`, `zeros`, `seq`} {
+		if S.StartsWith(name, prefix) {
+			n, err := strconv.Atoi(name[len(prefix):])
+			return err == nil && n > 0 && n <= 1024
+		}
+	}
+	return false
+}
+
+func ParseKeyTemplate(tmpl string) (*KeyTemplate, error) {
+	t := &KeyTemplate{}
+	// split levels on / outside of braces
+	levels := []string{}
+	depth, start := 0, 0
+	for z, c := range tmpl {
+		switch {
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		case c == '/' && depth == 0:
+			levels = append(levels, tmpl[start:z])
+			start = z + 1
+		}
+		if depth < 0 || depth > 1 {
+			return nil, fmt.Errorf(`unbalanced braces in key template %q`, tmpl)
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf(`unbalanced braces in key template %q`, tmpl)
+	}
+	levels = append(levels, tmpl[start:])
+
+	for _, str := range levels {
+		level := KeyLevel{FanMin: 1, FanMax: 1}
+		if S.EndsWith(str, `]`) && S.Contains(str, `[`) {
+			fan := str[strings.LastIndex(str, `[`)+1 : len(str)-1]
+			str = str[:strings.LastIndex(str, `[`)]
+			switch {
+			case fan == `f1`, fan == `f2`, fan == `f3`:
+				level.FanArg = int(fan[1] - '0')
+			case S.Contains(fan, `-`):
+				level.FanMin, level.FanMax = S.ToInt(S.LeftOf(fan, `-`)), S.ToInt(S.RightOf(fan, `-`))
+			default:
+				level.FanMin = S.ToInt(fan)
+				level.FanMax = level.FanMin
+			}
+			if level.FanArg == 0 && (level.FanMin < 1 || level.FanMax < level.FanMin) {
+				return nil, fmt.Errorf(`invalid fan-out [%s], expecting [N], [MIN-MAX] or [f1], [f2], [f3]`, fan)
+			}
+		}
+		if str == `` {
+			return nil, fmt.Errorf(`empty level in key template %q`, tmpl)
+		}
+		for str != `` {
+			open := strings.Index(str, `{`)
+			if open < 0 {
+				level.Parts = append(level.Parts, KeyPart{Literal: str})
+				break
+			}
+			if open > 0 {
+				level.Parts = append(level.Parts, KeyPart{Literal: str[:open]})
+			}
+			end := strings.Index(str, `}`)
+			choices := S.Split(str[open+1:end], `|`)
+			for _, name := range choices {
+				if !validPlaceholder(name) {
+					return nil, fmt.Errorf(`unknown placeholder {%s}, expecting uuid, int, hexN, zerosN, seq, seqN, time or time:LAYOUT`, name)
+				}
+			}
+			level.Parts = append(level.Parts, KeyPart{Choices: choices})
+			str = str[end+1:]
+		}
+		t.Levels = append(t.Levels, level)
+	}
+	return t, nil
+}
+
+// NextPlaceholder is the value of one placeholder, seq is 1-based position inside the parent
+func (s *Seed) NextPlaceholder(name string, seq int) string {
+	switch {
+	case name == `uuid`:
+		return s.NextUuid()
+	case name == `int`:
+		return strconv.FormatUint(s.NextInt64(), 10)
+	case name == `seq`:
+		return strconv.Itoa(seq)
+	case name == `time`:
+		return s.NextTime().Format(`20060102150405`)
+	case name == `hex`:
+		return s.NextHex16()
+	case S.StartsWith(name, `time:`):
+		return s.NextTime().Format(name[5:])
+	case S.StartsWith(name, `hex`):
+		return s.NextHexN(S.ToInt(name[3:]))
+	case S.StartsWith(name, `zeros`):
+		return strings.Repeat(`0`, S.ToInt(name[5:]))
+	case S.StartsWith(name, `seq`):
+		return fmt.Sprintf(`%0*d`, S.ToInt(name[3:]), seq)
+	}
+	return ``
+}
+
+func (s *Seed) NextTemplateFiles(t *KeyTemplate, maxFolder1, maxFolder2, maxFolder3 uint16) []string {
+	maxFolders := [4]int{1, int(maxFolder1), int(maxFolder2), int(maxFolder3)}
+	res := []string{}
+	var walk func(level int, prefix string)
+	walk = func(level int, prefix string) {
+		l := t.Levels[level]
+		min, max := l.FanMin, l.FanMax
+		if l.FanArg > 0 {
+			min, max = 1, maxFolders[l.FanArg]
+		}
+		count := min + int(s.Next()%uint64(max-min+1))
+		for seq := 1; seq <= count; seq++ {
+			name := prefix
+			for _, part := range l.Parts {
+				if part.Choices == nil {
+					name += part.Literal
+					continue
+				}
+				choice := part.Choices[0]
+				if len(part.Choices) > 1 {
+					choice = part.Choices[s.Next()%uint64(len(part.Choices))]
+				}
+				name += s.NextPlaceholder(choice, seq)
+			}
+			if level == len(t.Levels)-1 {
+				res = append(res, name)
+			} else {
+				walk(level+1, name+`/`)
+			}
+		}
+	}
+	walk(0, ``)
+	return res
+}
+
+// NewTemplatePattern is a pattern from a key template, keys relative to the bucket
+func NewTemplatePattern(tmpl string) (*Pattern, error) {
+	t, err := ParseKeyTemplate(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	return &Pattern{
+		NextFiles: func(s *Seed, maxFolder1, maxFolder2, maxFolder3 uint16) []string {
+			return s.NextTemplateFiles(t, maxFolder1, maxFolder2, maxFolder3)
+		},
+		Sizes:         []PatternSize{{regexp.MustCompile(``), `0`}},
+		ListDelimiter: `/`,
+		ListPrefix:    DirPrefix,
+	}, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// block size distribution and payload
+
+// Veeam block sizes after compression, from WAN (256K) to local 4MB/8MB blocks
+const veeamSizeDist = `256K:15,512K:35,1M:30,2M:10,4M:7,8M:3`
+
+// SizeDist is a fixed size (MIN), log-uniform range (MIN-MAX) or weighted list (SIZE:WEIGHT,...)
+type SizeDist struct {
+	Sizes   []uint64
+	Weights []uint64
+	Total   uint64
+	Min     uint64
+	Max     uint64
+}
+
+func ParseSizeDist(str string) (d SizeDist, err error) {
+	if str == `veeam` {
+		str = veeamSizeDist
+	}
+	if str == `0` {
+		return
+	}
+	if S.Contains(str, `-`) {
+		if d.Min, err = bytefmt.ToBytes(S.LeftOf(str, `-`)); err != nil {
+			return
+		}
+		if d.Max, err = bytefmt.ToBytes(S.RightOf(str, `-`)); err != nil {
+			return
+		}
+		if d.Max < d.Min {
+			err = fmt.Errorf(`size range %s is reversed`, str)
+		}
+		return
+	}
+	for _, item := range S.Split(str, `,`) {
+		size, weight := item, uint64(1)
+		if S.Contains(item, `:`) {
+			size, weight = S.LeftOf(item, `:`), S.ToU(S.RightOf(item, `:`))
+		}
+		var v uint64
+		if v, err = bytefmt.ToBytes(size); err != nil {
+			return
+		}
+		d.Sizes = append(d.Sizes, v)
+		d.Weights = append(d.Weights, weight)
+		d.Total += weight
+	}
+	if d.Total == 0 {
+		err = fmt.Errorf(`size list %s has no weight`, str)
+	}
+	return
+}
+
+// Size picks a size for random value h
+func (d SizeDist) Size(h uint64) uint64 {
+	if d.Total > 0 {
+		pick := h % d.Total
+		for z, w := range d.Weights {
+			if pick < w {
+				return d.Sizes[z]
+			}
+			pick -= w
+		}
+	}
+	if d.Max <= d.Min {
+		return d.Min
+	}
+	f := float64(h>>11) / (1 << 53) // 0..1
+	lo, hi := math.Log(float64(d.Min)), math.Log(float64(d.Max))
+	return uint64(math.Exp(lo + f*(hi-lo)))
+}
+
+// MetaSeed of runner z, apart from its PutSeed
+func MetaSeed(initial uint64, z int) Seed {
+	s := Seed(^(initial + uint64(z)))
+	s.Next()
+	return s
+}
+
+// ObjectSeed derives the payload seed of an object from the run seed and its name
+func ObjectSeed(initial uint64, objName string) Seed {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(objName))
+	s := Seed(initial ^ h.Sum64())
+	s.Next()
+	return s | 1 // 0 is a fixed point of murmur
+}
+
+// PayloadReader generates deterministic object content,
+// the first ZeroBytes of every 256 bytes are zero to make it compressible
+type PayloadReader struct {
+	Seed      Seed
+	Remain    uint64
+	ZeroBytes int
+	offset    uint64
+	word      uint64
+}
+
+func NewPayloadReader(seed Seed, size uint64, compressibility int) io.Reader {
+	if size == 0 {
+		// a non-nil empty body would be sent chunked
+		return http.NoBody
+	}
+	return &PayloadReader{Seed: seed, Remain: size, ZeroBytes: compressibility * 256 / 100}
+}
+
+func (p *PayloadReader) Read(b []byte) (int, error) {
+	if p.Remain == 0 {
+		return 0, io.EOF
+	}
+	if uint64(len(b)) > p.Remain {
+		b = b[:p.Remain]
+	}
+	for z := range b {
+		if p.offset%8 == 0 {
+			p.word = p.Seed.Next()
+		}
+		if int(p.offset%256) < p.ZeroBytes {
+			b[z] = 0
+		} else {
+			b[z] = byte(p.word >> (8 * (p.offset % 8)))
+		}
+		p.offset++
+	}
+	p.Remain -= uint64(len(b))
+	return len(b), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// key access distributions
+// copied from s3-benchmark, but picking 0-based positions
+
+type KeyPicker interface {
+	Pick(n int) int
+}
+
+func NewKeyPicker(name string, skew float64, hotspot string) (KeyPicker, error) {
+	switch name {
+	case `uniform`:
+		return UniformPicker{}, nil
+	case `sequential`:
+		return &SequentialPicker{}, nil
+	case `zipf`, `latest`:
+		if skew <= 0 || skew >= 1 {
+			return nil, fmt.Errorf(`zipf skew must be between 0 and 1, got %v`, skew)
+		}
+		if name == `latest` {
+			return LatestPicker{&ZipfPicker{Theta: skew}}, nil
+		}
+		return &ZipfPicker{Theta: skew}, nil
+	case `hotspot`:
+		keys, ops := S.ToF(S.LeftOf(hotspot, `:`)), S.ToF(S.RightOf(hotspot, `:`))
+		if keys <= 0 || keys > 100 || ops < 0 || ops > 100 {
+			return nil, fmt.Errorf(`hotspot must be KEYS%%:OPS%% between 0 and 100, got %q`, hotspot)
+		}
+		return HotspotPicker{HotKeys: keys / 100, HotOps: ops / 100}, nil
+	}
+	return nil, fmt.Errorf(`unknown key distribution %q, expecting uniform, zipf, hotspot, sequential or latest`, name)
+}
+
+type UniformPicker struct{}
+
+func (UniformPicker) Pick(n int) int {
+	return rand.Intn(n)
+}
+
+// SequentialPicker walks objects round-robin, runner z of a role with Step runners starts at z
+// and takes every Step-th object so the runners don't read the same objects in lockstep
+type SequentialPicker struct {
+	counter int
+	Step    int
+}
+
+// NewSequentialPicker is the picker of runner z out of runners
+func NewSequentialPicker(z, runners int) *SequentialPicker {
+	return &SequentialPicker{counter: z, Step: runners}
+}
+
+func (p *SequentialPicker) Pick(n int) int {
+	pos := p.counter % n
+	if p.Step > 1 {
+		p.counter += p.Step
+	} else {
+		p.counter++
+	}
+	if p.counter < 0 {
+		p.counter = 0
+	}
+	return pos
+}
+
+// HotspotPicker gives HotKeys fraction of the oldest objects HotOps fraction of the reads
+type HotspotPicker struct {
+	HotKeys float64
+	HotOps  float64
+}
+
+func (p HotspotPicker) Pick(n int) int {
+	hot := int(float64(n) * p.HotKeys)
+	if hot < 1 {
+		hot = 1
+	}
+	if hot >= n || rand.Float64() < p.HotOps {
+		return rand.Intn(hot)
+	}
+	return hot + rand.Intn(n-hot)
+}
+
+// ZipfPicker is YCSB zipfian (Gray et al.), the oldest object is the hottest
+type ZipfPicker struct {
+	Theta float64
+
+	n     int
+	zetan float64
+	zeta2 float64
+	alpha float64
+	eta   float64
+}
+
+func (p *ZipfPicker) Pick(n int) int {
+	if n != p.n {
+		// keyspace only grows, so extend zeta instead of recomputing
+		if n < p.n {
+			p.n, p.zetan = 0, 0
+		}
+		for i := p.n + 1; i <= n; i++ {
+			p.zetan += 1 / math.Pow(float64(i), p.Theta)
+		}
+		p.n = n
+		p.zeta2 = 1 + 1/math.Pow(2, p.Theta)
+		p.alpha = 1 / (1 - p.Theta)
+		p.eta = (1 - math.Pow(2/float64(n), 1-p.Theta)) / (1 - p.zeta2/p.zetan)
+	}
+	u := rand.Float64()
+	uz := u * p.zetan
+	if uz < 1 {
+		return 0
+	}
+	if uz < 1+math.Pow(0.5, p.Theta) && n >= 2 {
+		return 1
+	}
+	return I.MinOf(int(float64(n)*math.Pow(p.eta*u-p.eta+1, p.alpha)), n-1)
+}
+
+// LatestPicker is zipfian where the most recently written object is the hottest
+type LatestPicker struct {
+	Zipf *ZipfPicker
+}
+
+func (p LatestPicker) Pick(n int) int {
+	return n - 1 - p.Zipf.Pick(n)
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // flag parser for benchmark config
 
@@ -116,6 +838,9 @@ type BenchConfig struct {
 	SecretKey            string
 	GoPutCount           int
 	GoGetCount           int
+	GoHeadCount          int
+	GoCopyCount          int
+	GoMetaCount          int
 	GoListCount          int
 	GoDelCount           int
 	DurationSeconds      int
@@ -125,10 +850,45 @@ type BenchConfig struct {
 	MaxFolder2Capacity   uint16
 	MaxFolder3Capacity   uint16
 	BucketName           string
+	CopyBucketName       string
+	GetDistribution      string
+	ZipfSkew             float64
+	Hotspot              string
+	LockMode             string
+	LockDays             int
+	LockExtendSeconds    int
+	BlockSize            string
+	Compressibility      int
+	BlockSizeDist        SizeDist
+	MetaSize             string
+	MetaSizeDist         SizeDist
+	PatternName          string
+	KeyTemplate          string
+	StateFile            string
+	TLSVerify            bool
+	TLSCA                string
+	TLSCert              string
+	TLSKey               string
+	TLSMinVersion        string
+	TLSCiphers           string
+	TLSTickets           bool
+	KeepAlive            bool
+	MaxConns             int
+	MaxIdleConns         int
+	IdleTimeoutSeconds   int
+	ConnPool             string
+	HTTP2                bool
+	Compression          bool
+	ReadBuffer           string
+	WriteBuffer          string
+	TLSClientConfig      *tls.Config
+	Pattern              *Pattern
+	PatternSizeDists     []SizeDist
+	PatternReadRange     SizeDist
 }
 
 func (b *BenchConfig) MaxRoutineCount() int {
-	ints := []int{b.GoPutCount, b.GoGetCount, b.GoListCount, b.GoDelCount}
+	ints := []int{b.GoPutCount, b.GoGetCount, b.GoHeadCount, b.GoCopyCount, b.GoMetaCount, b.GoListCount, b.GoDelCount}
 	sort.Ints(ints)
 	return ints[len(ints)-1]
 }
@@ -136,10 +896,12 @@ func (b *BenchConfig) MaxRoutineCount() int {
 func (b *BenchConfig) ParseFromArgs(args []string) (string, int) {
 	l := len(args)
 	if l == 0 {
-		return `software to benchmark AWS S3-compatible service against VEEAM pattern
+		return `software to benchmark AWS S3-compatible service against VEEAM and other backup tool patterns
 
 put     --------------------
+meta    --------------------
 get         --------------------
+head        --------------------
 list             --------------------
 delete                --------------------
                  |....| --> delta duration (-d)
@@ -147,11 +909,15 @@ delete                --------------------
 
 usage:
   veeam-pattern ENDPOINT_URL ACCESS_KEY SECRET_KEY [other flags]
+  veeam-pattern verify ENDPOINT_URL ACCESS_KEY SECRET_KEY -m STATE_FILE [verify flags]
 
 other flags:
 -n set goroutine equivalent count for all APIs (int, default: 1, min: 1)
 -P set goroutine count for PutObject (int, default: 1, min: 1)
 -G set goroutine count for GetObject (int, default: 1, min: 1)
+-H set goroutine count for HeadObject (int, default: 1, min: 1)
+-C set goroutine count for CopyObject, synthetic full backup (int, default: 0, min: 0)
+-M set goroutine count for metadata: Owner/lock HEAD, lock create/release, .vbm/storage/checkpoint read-modify-write (int, default: 0, min: 0)
 -L set goroutine count for ListObjects (int, default: 1, min: 1)
 -D set goroutine count for DeleleteObject (int, default: 1, min: 1)
 -s duration seconds (int, default: 60, min: 4)
@@ -161,91 +927,139 @@ other flags:
 -f2 maximum number of content inside 2nd level uuid folder (int, default: 10, min: 2)
 -f3 maximum number of content inside 3rd level hex folder (int, default: 10, min: 2)
 -b bucket name (string, default: veeam-test)
+-p backup tool pattern: ` + strings.Join(PatternNames(), `, `) + ` (string, default: veeam)
+-t key template, overrides -p, see below (string, default: none)
+-m state file written after the run, for verify (string, default: none)
+-z block size: 0, SIZE, MIN-MAX (log-uniform), SIZE:WEIGHT,... or veeam (string, default: size mix of -p, 0 for veeam)
+   veeam = ` + veeamSizeDist + `
+-mz metadata object size, same format as -z (string, default: 4K-64K)
+-c compressibility percent of block content (int, default: 0, min: 0, max: 100)
+-cb destination bucket name for CopyObject (string, default: same as -b)
+-k key distribution for GetObject and HeadObject: uniform, zipf, hotspot, sequential, latest (string, default: sequential, restic: uniform, kopia, velero, kasten: latest)
+-kz skew of zipf and latest distribution (float, default: 0.99, between 0 and 1)
+-lm object lock mode for immutable backups: GOVERNANCE, COMPLIANCE (string, default: none)
+-ld object lock retention days of new objects (int, default: 30, min: 1)
+-le seconds between PutObjectRetention extension rounds, in lock mode (int, default: 10, min: 1)
+-kh hotspot distribution as KEYS%:OPS%, oldest KEYS% objects get OPS% of reads (string, default: 20:80)
+-tv verify the server certificate against the system CAs, 1 to verify (int, default: 0, implied by -tca)
+-tca PEM file of CA certificates to verify the server certificate against (string, default: none)
+-tcert PEM file of client certificate for mutual TLS (string, default: none)
+-tkey PEM file of the key of -tcert (string, default: none)
+-tmin minimum TLS version: 1.0, 1.1, 1.2, 1.3 (string, default: none)
+-tcs comma separated TLS 1.0-1.2 cipher suites, eg. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 (string, default: none)
+-tt resume TLS sessions with session tickets, 0 for a full handshake on every connection (int, default: 1)
+-ka keep connections open between requests, 0 for a new connection per request (int, default: 1)
+-mc maximum connections per host, requests wait for a free one, 0 for unlimited (int, default: 0)
+-mi maximum idle connections kept open per host (int, default: 4096)
+-it seconds until idle connections are closed (int, default: 60, min: 1)
+-cp connection pool: shared by all goroutines, or runner for one per goroutine (string, default: shared)
+-h2 negotiate HTTP/2 with https endpoints that support it, 1 to enable (int, default: 0)
+-gz ask for gzip responses, 0 to disable (int, default: 1)
+-rb read buffer size of each connection (string, default: 4K)
+-wb write buffer size of each connection (string, default: 4K)
 
 eg. UUID1/UUID2/blocks/HEX3/NUM4.HEX5.HEX6
          ^ -f1        ^ -f2  ^ -f3
 
 so f1 x f2 x f3 = total number of objects inside UUID1 folder
+
+verify flags, regenerate the keys of a run from its seed and check them:
+-m state file written by the run (string, required)
+-b bucket name (string, default: bucket of the run)
+-vm check with: list, head (string, default: list, head cannot find unexpected objects)
+-tv, -tca, -tcert, -tkey, -tmin, -tcs, -tt and the connection flags -ka ... -wb same as above
+
+other patterns, one backup session each, f1 x f2 = number of data objects:
+restic    restic/data/ID[:2]/ID ... index/ID, snapshots/ID
+kopia     kopia/pHEX-sSESSION-c1 ... qHEX-..., xn0_HEX-..., _log_...
+velero    velero/kopia/NAMESPACE/pHEX-... backups/NAME/NAME.tar.gz, velero-backup.json, ...
+kasten    k10/UUID/migration/NAMESPACE/kopia/pHEX-... restorepoints/UUID/manifest.json
+commvault commvault/CV_MAGNETIC/V_NUM/CHUNK_NUM/SFILE_CONTAINER_001 ... CHUNK_META_DATA_NUM
+          ^ -f1 chunks x -f2 SFILE_CONTAINER each
+
+key template, every / is a folder level, [N], [MIN-MAX] or [f1], [f2], [f3] is how many
+of that level inside its parent (default 1, [f1] is 1 to -f1), placeholders:
+{uuid} {int} {hex} {hexN} {zerosN} {seq} {seqN} (1-based position in parent, N zero padded)
+{time} {time:LAYOUT} (go time layout), {a|b} picks one of the placeholders with equal chance
+
+eg. -t '{uuid}/{uuid}[f1]/blocks/{hex16}[f2]/{int}.{hex16}.{hex16|zeros32}.blk[f3]'
+    -t 'backup/{time:2006-01-02}[1-3]/chunk_{seq4}[100]'
 `, 1
 	}
 	if l < 3 {
 		return `require endpoint, access, and secret key as first 3 arguments`, 2
 	}
-	b.Endpoint = args[0]
-	if !S.EndsWith(b.Endpoint, `/`) {
-		b.Endpoint += `/`
+	b.SetCredentials(args[0], args[1], args[2])
+
+	// pattern defaults go first, so command line flags override them
+	for z := 3; z+1 < l; z += 2 {
+		switch args[z] {
+		case `-p`:
+			b.PatternName = args[z+1]
+		case `-t`:
+			b.KeyTemplate = args[z+1]
+		}
 	}
-	if !S.StartsWith(b.Endpoint, `http`) {
-		b.Endpoint = `http://` + b.Endpoint
+	// -t overrides -p, whichever comes first
+	if b.KeyTemplate != `` {
+		b.PatternName = `template`
 	}
-	b.AccessKey = args[1]
-	b.SecretKey = args[2]
-
-	// helper func
-	u16 := func(s string, min uint16) uint16 {
-		v := uint16(S.ToInt(s))
-		if v < min {
-			return min
-		}
-		return v
+	if errStr, exitCode := b.LoadPattern(); exitCode != 0 {
+		return errStr, exitCode
 	}
-	i := func(s string, min int) int {
-		return I.MaxOf(S.ToInt(s), min)
+	for z := 0; z+1 < len(b.Pattern.Defaults); z += 2 {
+		b.SetFlag(b.Pattern.Defaults[z], b.Pattern.Defaults[z+1])
 	}
-
 	for z := 3; z < l; z += 2 {
 		key := args[z]
 		if z+1 >= l {
 			return `require argument for ` + key, 3
 		}
-		val := args[z+1]
-		switch key {
-		case `-P`:
-			b.GoPutCount = i(val, 1)
-		case `-G`:
-			b.GoGetCount = i(val, 1)
-		case `-D`:
-			b.GoDelCount = i(val, 1)
-		case `-L`:
-			b.GoListCount = i(val, 1)
-		case `-n`:
-			x := i(val, 1)
-			b.GoPutCount = x
-			b.GoGetCount = x
-			b.GoListCount = x
-			b.GoDelCount = x
-		case `-s`:
-			b.DurationSeconds = i(val, 4)
-		case `-d`:
-			b.DeltaDurationSeconds = i(val, 1)
-		case `-r`:
-			b.InitialSeed = I.UMax(S.ToU(val), 1)
-		case `-f1`:
-			b.MaxFolder1Capacity = u16(val, 2)
-		case `-f2`:
-			b.MaxFolder2Capacity = u16(val, 2)
-		case `-f3`:
-			b.MaxFolder3Capacity = u16(val, 2)
-		case `-b`:
-			b.BucketName = val
+		b.SetFlag(key, args[z+1])
+	}
+	if _, err := NewKeyPicker(b.GetDistribution, b.ZipfSkew, b.Hotspot); err != nil {
+		return err.Error(), 4
+	}
+	var err error
+	if b.BlockSize != `` {
+		if b.BlockSizeDist, err = ParseSizeDist(b.BlockSize); err != nil {
+			return `invalid -z: ` + err.Error(), 6
+		}
+	}
+	b.PatternSizeDists = make([]SizeDist, len(b.Pattern.Sizes))
+	for z, ps := range b.Pattern.Sizes {
+		if b.PatternSizeDists[z], err = ParseSizeDist(ps.Size); err != nil {
+			return `invalid size of pattern ` + b.PatternName + `: ` + err.Error(), 6
 		}
 	}
-	if b.GoPutCount < b.GoGetCount {
-		b.GoGetCount = b.GoPutCount
-		fmt.Println(`overriding -G with -P`)
+	if b.Pattern.ReadRange != `` {
+		if b.PatternReadRange, err = ParseSizeDist(b.Pattern.ReadRange); err != nil {
+			return `invalid read range of pattern ` + b.PatternName + `: ` + err.Error(), 6
+		}
+	}
+	if b.MetaSizeDist, err = ParseSizeDist(b.MetaSize); err != nil {
+		return `invalid -mz: ` + err.Error(), 6
+	}
+	if !b.Pattern.Meta {
+		// only veeam has metadata role
+		b.GoMetaCount = 0
 	}
-	if b.GoPutCount < b.GoListCount {
-		b.GoListCount = b.GoPutCount
-		fmt.Println(`overriding -L with -P`)
+	if b.LockMode != `` && b.LockMode != s3.ObjectLockModeGovernance && b.LockMode != s3.ObjectLockModeCompliance {
+		return `-lm must be GOVERNANCE or COMPLIANCE`, 5
 	}
-	if b.GoPutCount < b.GoDelCount {
-		b.GoDelCount = b.GoPutCount
-		fmt.Println(`overriding -D with -P`)
+	if b.CopyBucketName == `` {
+		b.CopyBucketName = b.BucketName
+	}
+	if errStr, exitCode := b.ApplyTransport(); exitCode != 0 {
+		return errStr, exitCode
 	}
 	fmt.Println(`configuration:`,
 		b.Endpoint, b.AccessKey, b.SecretKey,
 		`-P`, b.GoPutCount,
 		`-G`, b.GoGetCount,
+		`-H`, b.GoHeadCount,
+		`-C`, b.GoCopyCount,
+		`-M`, b.GoMetaCount,
 		`-L`, b.GoListCount,
 		`-D`, b.GoDelCount,
 		`-s`, b.DurationSeconds,
@@ -254,14 +1068,185 @@ so f1 x f2 x f3 = total number of objects inside UUID1 folder
 		`-f1`, b.MaxFolder1Capacity,
 		`-f2`, b.MaxFolder2Capacity,
 		`-f3`, b.MaxFolder3Capacity,
-		`-b`, b.BucketName)
+		`-b`, b.BucketName,
+		`-cb`, b.CopyBucketName,
+		`-k`, b.GetDistribution,
+		`-kz`, b.ZipfSkew,
+		`-kh`, b.Hotspot,
+		`-lm`, b.LockMode,
+		`-ld`, b.LockDays,
+		`-le`, b.LockExtendSeconds,
+		`-z`, b.BlockSize,
+		`-mz`, b.MetaSize,
+		`-c`, b.Compressibility,
+		`-p`, b.PatternName,
+		`-t`, b.KeyTemplate,
+		`-m`, b.StateFile,
+		`-tv`, b.TLSVerify,
+		`-tca`, b.TLSCA,
+		`-tcert`, b.TLSCert,
+		`-tkey`, b.TLSKey,
+		`-tmin`, b.TLSMinVersion,
+		`-tcs`, b.TLSCiphers,
+		`-tt`, b.TLSTickets,
+		`-ka`, b.KeepAlive,
+		`-mc`, b.MaxConns,
+		`-mi`, b.MaxIdleConns,
+		`-it`, b.IdleTimeoutSeconds,
+		`-cp`, b.ConnPool,
+		`-h2`, b.HTTP2,
+		`-gz`, b.Compression,
+		`-rb`, b.ReadBuffer,
+		`-wb`, b.WriteBuffer)
 	return ``, 0
 }
 
+func (b *BenchConfig) SetCredentials(endpoint, accessKey, secretKey string) {
+	b.Endpoint = endpoint
+	if !S.EndsWith(b.Endpoint, `/`) {
+		b.Endpoint += `/`
+	}
+	if !S.StartsWith(b.Endpoint, `http`) {
+		b.Endpoint = `http://` + b.Endpoint
+	}
+	b.AccessKey = accessKey
+	b.SecretKey = secretKey
+}
+
+// LoadPattern sets Pattern from PatternName or KeyTemplate
+func (b *BenchConfig) LoadPattern() (string, int) {
+	b.Pattern = Patterns[b.PatternName]
+	if b.PatternName == `template` {
+		var err error
+		if b.Pattern, err = NewTemplatePattern(b.KeyTemplate); err != nil {
+			return `invalid -t: ` + err.Error(), 8
+		}
+	}
+	if b.Pattern == nil {
+		return `unknown pattern ` + b.PatternName + `, expecting one of: ` + strings.Join(PatternNames(), `, `), 7
+	}
+	return ``, 0
+}
+
+func (b *BenchConfig) SetFlag(key, val string) {
+	// helper func
+	u16 := func(s string, min uint16) uint16 {
+		v := uint16(S.ToInt(s))
+		if v < min {
+			return min
+		}
+		return v
+	}
+	i := func(s string, min int) int {
+		return I.MaxOf(S.ToInt(s), min)
+	}
+
+	switch key {
+	case `-P`:
+		b.GoPutCount = i(val, 1)
+	case `-G`:
+		b.GoGetCount = i(val, 1)
+	case `-H`:
+		b.GoHeadCount = i(val, 1)
+	case `-C`:
+		b.GoCopyCount = i(val, 0)
+	case `-M`:
+		b.GoMetaCount = i(val, 0)
+	case `-D`:
+		b.GoDelCount = i(val, 1)
+	case `-L`:
+		b.GoListCount = i(val, 1)
+	case `-n`:
+		x := i(val, 1)
+		b.GoPutCount = x
+		b.GoGetCount = x
+		b.GoHeadCount = x
+		b.GoListCount = x
+		b.GoDelCount = x
+	case `-s`:
+		b.DurationSeconds = i(val, 4)
+	case `-d`:
+		b.DeltaDurationSeconds = i(val, 1)
+	case `-r`:
+		b.InitialSeed = I.UMax(S.ToU(val), 1)
+	case `-f1`:
+		b.MaxFolder1Capacity = u16(val, 2)
+	case `-f2`:
+		b.MaxFolder2Capacity = u16(val, 2)
+	case `-f3`:
+		b.MaxFolder3Capacity = u16(val, 2)
+	case `-b`:
+		b.BucketName = val
+	case `-cb`:
+		b.CopyBucketName = val
+	case `-k`:
+		b.GetDistribution = val
+	case `-kz`:
+		b.ZipfSkew = S.ToF(val)
+	case `-kh`:
+		b.Hotspot = val
+	case `-lm`:
+		b.LockMode = S.ToUpper(val)
+	case `-ld`:
+		b.LockDays = i(val, 1)
+	case `-le`:
+		b.LockExtendSeconds = i(val, 1)
+	case `-p`:
+		if b.KeyTemplate == `` {
+			b.PatternName = val
+		}
+	case `-t`:
+		b.KeyTemplate = val
+		b.PatternName = `template`
+	case `-m`:
+		b.StateFile = val
+	case `-z`:
+		b.BlockSize = val
+	case `-mz`:
+		b.MetaSize = val
+	case `-c`:
+		b.Compressibility = I.MinOf(i(val, 0), 100)
+	case `-tv`:
+		b.TLSVerify = val == `1`
+	case `-tca`:
+		b.TLSCA = val
+	case `-tcert`:
+		b.TLSCert = val
+	case `-tkey`:
+		b.TLSKey = val
+	case `-tmin`:
+		b.TLSMinVersion = val
+	case `-tcs`:
+		b.TLSCiphers = val
+	case `-tt`:
+		b.TLSTickets = val != `0`
+	case `-ka`:
+		b.KeepAlive = val != `0`
+	case `-mc`:
+		b.MaxConns = i(val, 0)
+	case `-mi`:
+		b.MaxIdleConns = i(val, 0)
+	case `-it`:
+		b.IdleTimeoutSeconds = i(val, 1)
+	case `-cp`:
+		b.ConnPool = val
+	case `-h2`:
+		b.HTTP2 = val == `1`
+	case `-gz`:
+		b.Compression = val != `0`
+	case `-rb`:
+		b.ReadBuffer = val
+	case `-wb`:
+		b.WriteBuffer = val
+	}
+}
+
 func (b *BenchConfig) SetDefaults() {
 	b.InitialSeed = 1
 	b.GoPutCount = 1
 	b.GoGetCount = 1
+	b.GoHeadCount = 1
+	b.GoMetaCount = 0
 	b.GoListCount = 1
 	b.GoDelCount = 1
 	b.DurationSeconds = 60
@@ -270,6 +1255,140 @@ func (b *BenchConfig) SetDefaults() {
 	b.MaxFolder2Capacity = 10
 	b.MaxFolder3Capacity = 10
 	b.BucketName = `veeam-test`
+	b.GetDistribution = `sequential`
+	b.ZipfSkew = 0.99
+	b.Hotspot = `20:80`
+	b.LockDays = 30
+	b.LockExtendSeconds = 10
+	b.PatternName = `veeam`
+	b.MetaSize = `4K-64K`
+	b.TLSTickets = true
+	b.KeepAlive = true
+	b.MaxIdleConns = 4096
+	b.IdleTimeoutSeconds = 60
+	b.ConnPool = `shared`
+	b.Compression = true
+	b.ReadBuffer = `4K`
+	b.WriteBuffer = `4K`
+}
+
+var tlsVersions = map[string]uint16{`1.0`: tls.VersionTLS10, `1.1`: tls.VersionTLS11, `1.2`: tls.VersionTLS12, `1.3`: tls.VersionTLS13}
+
+// TLSConfig builds the client TLS settings from the -t* flags
+func (b *BenchConfig) TLSConfig() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: !b.TLSVerify && b.TLSCA == ``}
+	if b.TLSCA != `` {
+		pem, err := ioutil.ReadFile(b.TLSCA)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf(`no PEM certificates in %s`, b.TLSCA)
+		}
+	}
+	if b.TLSCert != `` || b.TLSKey != `` {
+		cert, err := tls.LoadX509KeyPair(b.TLSCert, b.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf(`client certificate: %v`, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if b.TLSMinVersion != `` {
+		version, ok := tlsVersions[b.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf(`unknown minimum version %s, expecting 1.0, 1.1, 1.2 or 1.3`, b.TLSMinVersion)
+		}
+		config.MinVersion = version
+	}
+	if b.TLSCiphers != `` {
+		suites := map[string]uint16{}
+		for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			suites[suite.Name] = suite.ID
+		}
+		for _, name := range strings.Split(b.TLSCiphers, `,`) {
+			id, ok := suites[name]
+			if !ok {
+				return nil, fmt.Errorf(`unknown cipher suite %s`, name)
+			}
+			config.CipherSuites = append(config.CipherSuites, id)
+		}
+	}
+	// without a session cache every new connection does a full handshake
+	if b.TLSTickets {
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	} else {
+		config.SessionTicketsDisabled = true
+	}
+	return config, nil
+}
+
+// ApplyTransport checks the TLS and connection flags and sets up the shared transport
+func (b *BenchConfig) ApplyTransport() (string, int) {
+	var err error
+	if b.TLSClientConfig, err = b.TLSConfig(); err != nil {
+		return `invalid TLS flags: ` + err.Error(), 10
+	}
+	for _, size := range []string{b.ReadBuffer, b.WriteBuffer} {
+		if _, err = bytefmt.ToBytes(size); err != nil {
+			return `invalid -rb or -wb: ` + err.Error(), 10
+		}
+	}
+	if b.ConnPool != `shared` && b.ConnPool != `runner` {
+		return `-cp must be shared or runner`, 10
+	}
+	HTTPTransport = b.NewTransport()
+	HTTPClient.Transport = HTTPTransport
+	return ``, 0
+}
+
+// NewTransport is an HTTP transport with its own connection pool
+func (b *BenchConfig) NewTransport() *http.Transport {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !b.KeepAlive {
+		dialer.KeepAlive = -1
+	}
+	config := b.TLSClientConfig.Clone()
+	// Clone shares the session cache, a pool of its own resumes only its own sessions
+	if config.ClientSessionCache != nil {
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+	if b.HTTP2 {
+		config.NextProtos = []string{`h2`, `http/1.1`}
+	}
+	readBuffer, _ := bytefmt.ToBytes(b.ReadBuffer)
+	writeBuffer, _ := bytefmt.ToBytes(b.WriteBuffer)
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		DialTLSContext:        TLSDialer(config, dialer.DialContext),
+		TLSClientConfig:       config,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 0,
+		MaxIdleConnsPerHost:   b.MaxIdleConns,
+		MaxIdleConns:          0,
+		MaxConnsPerHost:       b.MaxConns,
+		IdleConnTimeout:       time.Duration(b.IdleTimeoutSeconds) * time.Second,
+		DisableKeepAlives:     !b.KeepAlive,
+		DisableCompression:    !b.Compression,
+		ReadBufferSize:        int(readBuffer),
+		WriteBufferSize:       int(writeBuffer),
+		// HTTP/2 is negotiated over TLS only
+		ForceAttemptHTTP2: b.HTTP2,
+	}
+}
+
+// SizeDistOf is -z when given, otherwise the pattern size mix of the object
+func (b *BenchConfig) SizeDistOf(obj string) SizeDist {
+	if b.BlockSize != `` {
+		return b.BlockSizeDist
+	}
+	for z, ps := range b.Pattern.Sizes {
+		if ps.Match.MatchString(obj) {
+			return b.PatternSizeDists[z]
+		}
+	}
+	return SizeDist{}
 }
 
 func (b *BenchConfig) TotalDuration() int {
@@ -281,8 +1400,9 @@ func (b *BenchConfig) TotalDuration() int {
 
 type S3Client struct {
 	*s3.S3
-	accessKey string
-	secretKey string
+	accessKey  string
+	secretKey  string
+	httpClient *http.Client
 }
 
 func (S3Client) canonicalAmzHeaders(req *http.Request) string {
@@ -329,7 +1449,236 @@ func (s S3Client) setSignature(req *http.Request) {
 
 func (s *S3Client) Hit(req *http.Request) (*http.Response, error) {
 	s.setSignature(req)
-	return HTTPClient.Do(req)
+	return s.httpClient.Do(req)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// role windows and interval samples
+
+const (
+	RolePut = iota
+	RoleGet
+	RoleHead
+	RoleCopy
+	RoleMeta
+	RoleList
+	RoleDel
+	roleCount
+)
+
+var roleNames = [roleCount]string{`PUT`, `GET`, `HEAD`, `COPY`, `META`, `LIST`, `DEL`}
+
+// RoleWindow is wall-clock time from the first runner start to the last runner end of a role
+type RoleWindow struct {
+	Start int64 // unix nano
+	End   int64
+}
+
+func (w *RoleWindow) Mark(start, end time.Time) {
+	for {
+		old := atomic.LoadInt64(&w.Start)
+		if old != 0 && old <= start.UnixNano() || atomic.CompareAndSwapInt64(&w.Start, old, start.UnixNano()) {
+			break
+		}
+	}
+	for {
+		old := atomic.LoadInt64(&w.End)
+		if old >= end.UnixNano() || atomic.CompareAndSwapInt64(&w.End, old, end.UnixNano()) {
+			break
+		}
+	}
+}
+
+// Overlap is how long the role ran during [start, end)
+func (w *RoleWindow) Overlap(start, end time.Time) time.Duration {
+	from, to := start.UnixNano(), end.UnixNano()
+	if w.Start == 0 || w.Start >= to || w.End <= from {
+		return 0
+	}
+	if w.Start > from {
+		from = w.Start
+	}
+	if w.End < to {
+		to = w.End
+	}
+	return time.Duration(to - from)
+}
+
+func (w *RoleWindow) Seconds() float64 {
+	return float64(w.End-w.Start) / 1e9
+}
+
+// Sample is cumulative counters at a point in time
+type Sample struct {
+	At    time.Time
+	Ops   [roleCount]int64
+	Bytes [roleCount]int64
+	Errs  [roleCount]int64
+	Rows  int64
+}
+
+// Interval is the difference between two samples
+type Interval struct {
+	Start time.Time
+	End   time.Time
+	Ops   [roleCount]int64
+	Bytes [roleCount]int64
+}
+
+func (i Interval) Seconds() float64 {
+	return i.End.Sub(i.Start).Seconds()
+}
+
+// RoleRate is throughput of a role over some seconds
+type RoleRate struct {
+	Ops     int64
+	Bytes   int64
+	Seconds float64
+}
+
+// Add counts the part of the interval inside the role window
+func (r *RoleRate) Add(i Interval, role int, w *RoleWindow) {
+	r.Ops += i.Ops[role]
+	r.Bytes += i.Bytes[role]
+	r.Seconds += w.Overlap(i.Start, i.End).Seconds()
+}
+
+func (r RoleRate) String() string {
+	if r.Seconds <= 0 {
+		return `-`
+	}
+	if r.Bytes == 0 {
+		return fmt.Sprintf(`%.1f/s (%.1fs)`, float64(r.Ops)/r.Seconds, r.Seconds)
+	}
+	return fmt.Sprintf(`%.1f/s %sB/s (%.1fs)`, float64(r.Ops)/r.Seconds, ByteSize(uint64(float64(r.Bytes)/r.Seconds)), r.Seconds)
+}
+
+// ByteSize without unit for zero, bytefmt gives 0B
+func ByteSize(n uint64) string {
+	if n == 0 {
+		return `0`
+	}
+	return bytefmt.ByteSize(n)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// shared object pool
+// keys of all PUT runners in one place, readers and deleters only see readable objects
+
+type ObjectState uint8
+
+const (
+	ObjectWritten  ObjectState = iota // PUT sent
+	ObjectReadable                    // PUT succeeded
+	ObjectDeleted                     // claimed by DELETE
+	ObjectFailed                      // PUT failed
+	ObjectRetained                    // DELETE rejected by object lock
+)
+
+type ObjectPool struct {
+	mutex    sync.Mutex
+	Keys     []string
+	States   []ObjectState
+	Versions []string
+	// positions in commit order, oldest first, readable[head:] are still readable
+	readable []int
+	head     int
+}
+
+// Add registers a key about to be written
+func (p *ObjectPool) Add(key string) (pos int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.Keys = append(p.Keys, key)
+	p.States = append(p.States, ObjectWritten)
+	p.Versions = append(p.Versions, ``)
+	return len(p.Keys) - 1
+}
+
+// Commit makes a written object readable
+func (p *ObjectPool) Commit(pos int, versionId string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.States[pos] = ObjectReadable
+	p.Versions[pos] = versionId
+	p.readable = append(p.readable, pos)
+}
+
+func (p *ObjectPool) Fail(pos int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.States[pos] = ObjectFailed
+}
+
+func (p *ObjectPool) ReadableCount() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return len(p.readable) - p.head
+}
+
+// Pick chooses a readable object, 0 is the oldest
+func (p *ObjectPool) Pick(picker KeyPicker) (pos int, key string, ok bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	n := len(p.readable) - p.head
+	if n <= 0 {
+		return 0, ``, false
+	}
+	pos = p.readable[p.head+picker.Pick(n)]
+	return pos, p.Keys[pos], true
+}
+
+// ClaimOldest takes the oldest readable object for deletion, like retention does
+func (p *ObjectPool) ClaimOldest() (pos int, key, versionId string, ok bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.head >= len(p.readable) {
+		return 0, ``, ``, false
+	}
+	pos = p.readable[p.head]
+	p.head++
+	p.States[pos] = ObjectDeleted
+	return pos, p.Keys[pos], p.Versions[pos], true
+}
+
+// Restore makes an object readable again after a rejected delete, as the newest
+func (p *ObjectPool) Restore(pos int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.States[pos] = ObjectReadable
+	p.readable = append(p.readable, pos)
+}
+
+// Retain marks a claimed object as kept by the server
+func (p *ObjectPool) Retain(pos int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.States[pos] = ObjectRetained
+}
+
+// KeysIn is all keys having the state
+func (p *ObjectPool) KeysIn(state ObjectState) (keys []string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for pos, st := range p.States {
+		if st == state {
+			keys = append(keys, p.Keys[pos])
+		}
+	}
+	return
+}
+
+// ReadableVersions is a snapshot of the readable objects where pos%mod == rem
+func (p *ObjectPool) ReadableVersions(mod, rem int) (keys, versionIds []string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, pos := range p.readable[p.head:] {
+		if pos%mod == rem {
+			keys = append(keys, p.Keys[pos])
+			versionIds = append(versionIds, p.Versions[pos])
+		}
+	}
+	return
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -338,16 +1687,43 @@ func (s *S3Client) Hit(req *http.Request) (*http.Response, error) {
 type BenchmarkSuite struct {
 	PutCount  int64
 	GetCount  int64
+	HeadCount int64
+	CopyCount int64
 	ListCount int64
 	DelCount  int64
 
 	ListRowsCount int64
 
+	MetaCount  int64
+	MetaCycles int64
+	MetaErr    int64
+
+	PutBytes  int64
+	GetBytes  int64
+	CopyBytes int64
+
+	// object lock
+	ExtendCount    int64
+	ExtendErr      int64
+	LockRejected   int64
+	LockViolations int64
+
 	PutErr  int64
 	GetErr  int64
+	HeadErr int64
+	CopyErr int64
 	ListErr int64
 	DelErr  int64
 
+	// reads of objects deleted after they were picked
+	GetMiss  int64
+	HeadMiss int64
+
+	Windows   [roleCount]RoleWindow
+	Intervals []Interval
+
+	Pool ObjectPool
+
 	Runner []BenchmarkSteps
 
 	Config *BenchConfig
@@ -357,36 +1733,100 @@ func (s *BenchmarkSuite) FromConfig(b *BenchConfig) *BenchmarkSuite {
 	s.Runner = make([]BenchmarkSteps, b.MaxRoutineCount())
 	s.Config = b
 	for z := 0; z < b.MaxRoutineCount(); z++ {
+		getPicker, _ := NewKeyPicker(b.GetDistribution, b.ZipfSkew, b.Hotspot)
+		if seq, ok := getPicker.(*SequentialPicker); ok {
+			*seq = *NewSequentialPicker(z, b.GoGetCount)
+		}
+		headPicker, _ := NewKeyPicker(b.GetDistribution, b.ZipfSkew, b.Hotspot)
+		if seq, ok := headPicker.(*SequentialPicker); ok {
+			*seq = *NewSequentialPicker(z, b.GoHeadCount)
+		}
 		s.Runner[z] = BenchmarkSteps{
-			PutSeed: Seed(b.InitialSeed + uint64(z)),
-			Config:  b,
-			Suite:   s,
+			PutSeed:    Seed(b.InitialSeed + uint64(z)),
+			MetaSeed:   MetaSeed(b.InitialSeed, z),
+			GetPicker:  getPicker,
+			HeadPicker: headPicker,
+			CopyPicker: NewSequentialPicker(z, b.GoCopyCount),
+			ListPicker: NewSequentialPicker(z, b.GoListCount),
+			Config:     b,
+			Suite:      s,
 		}
 	}
 	return s
 }
 
-// copied from wasabi
-var HTTPTransport http.RoundTripper = &http.Transport{
-	Proxy: http.ProxyFromEnvironment,
-	Dial: (&net.Dialer{
-		Timeout:   30 * time.Second,
-		KeepAlive: 30 * time.Second,
-	}).Dial,
-	TLSHandshakeTimeout:   10 * time.Second,
-	ExpectContinueTimeout: 0,
-	// Allow an unlimited number of idle connections
-	MaxIdleConnsPerHost: 4096,
-	MaxIdleConns:        0,
-	// But limit their idle time
-	IdleConnTimeout: time.Minute,
-	// Ignore TLS errors
-	TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-}
-var HTTPClient = &http.Client{Transport: HTTPTransport}
+// copied from wasabi, set up by BenchConfig.ApplyTransport
+var HTTPTransport http.RoundTripper
+var HTTPClient = &http.Client{}
+
+// TLSStats counts the handshakes of all connections
+type TLSStats struct {
+	Handshakes int64
+	Resumed    int64
+	Errors     int64
+	Nanos      int64
+	MaxNanos   int64
+}
+
+var TLSHandshakes TLSStats
+
+// TLSDialer does the handshake over dial itself so every handshake is counted and timed
+func TLSDialer(config *tls.Config, dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		raw, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		connConfig := config.Clone()
+		if connConfig.ServerName == `` {
+			connConfig.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		conn := tls.Client(raw, connConfig)
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		start := time.Now()
+		err = conn.HandshakeContext(ctx)
+		TLSHandshakes.Record(time.Since(start), err == nil && conn.ConnectionState().DidResume, err)
+		if err != nil {
+			raw.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+func (t *TLSStats) Record(d time.Duration, resumed bool, err error) {
+	atomic.AddInt64(&t.Handshakes, 1)
+	atomic.AddInt64(&t.Nanos, int64(d))
+	for {
+		max := atomic.LoadInt64(&t.MaxNanos)
+		if int64(d) <= max || atomic.CompareAndSwapInt64(&t.MaxNanos, max, int64(d)) {
+			break
+		}
+	}
+	if resumed {
+		atomic.AddInt64(&t.Resumed, 1)
+	}
+	if err != nil {
+		atomic.AddInt64(&t.Errors, 1)
+	}
+}
+
+func (t *TLSStats) String() string {
+	n := atomic.LoadInt64(&t.Handshakes)
+	total := time.Duration(atomic.LoadInt64(&t.Nanos))
+	return fmt.Sprintf(`%5d handshakes (%d resumed, %d ERR), avg %v, max %v, total %.3fs`,
+		n, atomic.LoadInt64(&t.Resumed), atomic.LoadInt64(&t.Errors),
+		total/time.Duration(n), time.Duration(atomic.LoadInt64(&t.MaxNanos)), total.Seconds())
+}
 
+// CreateS3Client is a client over the shared connection pool, or a pool of its own with -cp runner
 func (s *BenchmarkSuite) CreateS3Client() S3Client {
 	conf := s.Config
+	httpClient := HTTPClient
+	if conf.ConnPool == `runner` {
+		httpClient = &http.Client{Transport: conf.NewTransport()}
+	}
 	creds := credentials.NewStaticCredentials(conf.AccessKey, conf.SecretKey, "")
 	loglevel := aws.LogOff
 	// Build the rest of the configuration
@@ -398,14 +1838,14 @@ func (s *BenchmarkSuite) CreateS3Client() S3Client {
 		S3ForcePathStyle:     aws.Bool(true),
 		S3Disable100Continue: aws.Bool(true),
 		// Comment following to use default transport
-		HTTPClient: &http.Client{Transport: HTTPTransport},
+		HTTPClient: httpClient,
 	}
 	sess := session.New(awsConfig)
 	client := s3.New(sess)
 	if client == nil {
 		log.Fatalf("FATAL: Unable to create new client.")
 	}
-	return S3Client{client, conf.AccessKey, conf.SecretKey}
+	return S3Client{client, conf.AccessKey, conf.SecretKey, httpClient}
 }
 
 func (s *BenchmarkSuite) Run() {
@@ -426,98 +1866,197 @@ func (s *BenchmarkSuite) Run() {
 		}(z)
 	}
 
-	// print progress
+	// print progress, rates are of the last interval
 	toRate := func(n int64, sec float64) float64 {
+		if sec <= 0 {
+			return 0
+		}
 		return float64(n) / sec
 	}
+	toBytes := func(n int64, sec float64) string {
+		return ByteSize(uint64(toRate(n, sec)))
+	}
 	totalDur := s.Config.TotalDuration()
-	printer := func(seconds int) string {
-		sec := I.MinOf(seconds, s.Config.DurationSeconds)
-		fsec := float64(sec)
-		return fmt.Sprintf("%d (%.1f/s, %d err) put, %d (%.1f/s, %d err) get, %d (%.1f/s, rows=%d, %.1f rows/s, %d err) list, %d (%.1f/s, %d err) del | %.2f%%%% ~%ds\n",
-			s.PutCount, toRate(s.PutCount, fsec), s.PutErr,
-			s.GetCount, toRate(s.GetCount, fsec), s.GetErr,
-			s.ListCount, toRate(s.ListCount, fsec),
-			s.ListRowsCount, toRate(s.ListRowsCount, fsec), s.ListErr,
-			s.DelCount, toRate(s.DelCount, fsec), s.DelErr,
-			100*float32(seconds)/float32(totalDur), totalDur-seconds)
+	begin := time.Now()
+	printer := func(c Sample, i Interval) string {
+		sec := i.Seconds()
+		elapsed := int(i.End.Sub(begin).Seconds())
+		return fmt.Sprintf("%d (%.1f/s, %sB/s, %d err) put, %d (%.1f/s, %sB/s, %d err) get, %d (%.1f/s, %d err) head, %d (%.1f/s, %sB/s, %d err) copy, %d (%.1f/s, %d err) meta, %d (%.1f/s, rows=%d, %d err) list, %d (%.1f/s, %d err) del | %.2f%%%% ~%ds\n",
+			c.Ops[RolePut], toRate(i.Ops[RolePut], sec), toBytes(i.Bytes[RolePut], sec), c.Errs[RolePut],
+			c.Ops[RoleGet], toRate(i.Ops[RoleGet], sec), toBytes(i.Bytes[RoleGet], sec), c.Errs[RoleGet],
+			c.Ops[RoleHead], toRate(i.Ops[RoleHead], sec), c.Errs[RoleHead],
+			c.Ops[RoleCopy], toRate(i.Ops[RoleCopy], sec), toBytes(i.Bytes[RoleCopy], sec), c.Errs[RoleCopy],
+			c.Ops[RoleMeta], toRate(i.Ops[RoleMeta], sec), c.Errs[RoleMeta],
+			c.Ops[RoleList], toRate(i.Ops[RoleList], sec), c.Rows, c.Errs[RoleList],
+			c.Ops[RoleDel], toRate(i.Ops[RoleDel], sec), c.Errs[RoleDel],
+			100*float32(elapsed)/float32(totalDur), totalDur-elapsed)
 	}
+	done := make(chan struct{})
+	sampled := make(chan struct{})
 	go func() {
-		for z := 1; z <= totalDur; z++ {
-			time.Sleep(time.Second)
+		defer close(sampled)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		prev := s.Sample()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				s.Intervals = append(s.Intervals, s.Interval(prev, s.Sample()))
+				return
+			}
+			cur := s.Sample()
+			interval := s.Interval(prev, cur)
+			s.Intervals = append(s.Intervals, interval)
+			prev = cur
 			term.Clear()
-			_, _ = fmt.Fprintf(term, printer(z))
+			_, _ = fmt.Fprintf(term, printer(cur, interval))
 			_ = term.Print()
 		}
 	}()
 
 	// wait for finish
 	wg.Wait()
+	close(done)
+	<-sampled
 	term.Clear()
 
-	// print final result
-	printer(totalDur)
-	listDur := s.AverageListDuration()
+	// print final result, over the wall-clock window of each role
+	window := func(role int) float64 {
+		return s.Windows[role].Seconds()
+	}
 	fmt.Printf(`
-PUT  %5d (%4.1f/s, %d ERR)
-GET  %5d (%4.1f/s, %d ERR)
+PUT  %5d (%4.1f/s, %sB/s, %d ERR)
+GET  %5d (%4.1f/s, %sB/s, %d ERR, %d MISS)
+HEAD %5d (%4.1f/s, %d ERR, %d MISS)
+COPY %5d (%4.1f/s, %sB/s, %d ERR)
+META %5d (%4.1f/s, %d ERR, %d cycles)
 LIST %5d (%4.1f/s, %d ERR, %d rows, %.1f rows/s)
 DEL  %5d (%4.1f/s, %d ERR)
 `,
-		s.PutCount, toRate(s.PutCount, s.AveragePutDuration()), s.PutErr,
-		s.GetCount, toRate(s.GetCount, s.AverageGetDuration()), s.GetErr,
-		s.ListCount, toRate(s.ListCount, listDur), s.ListErr,
-		s.ListRowsCount, toRate(s.ListRowsCount, listDur),
-		s.DelCount, toRate(s.DelCount, s.AverageDelDuration()), s.DelErr)
-}
+		s.PutCount, toRate(s.PutCount, window(RolePut)), toBytes(s.PutBytes, window(RolePut)), s.PutErr,
+		s.GetCount, toRate(s.GetCount, window(RoleGet)), toBytes(s.GetBytes, window(RoleGet)), s.GetErr, s.GetMiss,
+		s.HeadCount, toRate(s.HeadCount, window(RoleHead)), s.HeadErr, s.HeadMiss,
+		s.CopyCount, toRate(s.CopyCount, window(RoleCopy)), toBytes(s.CopyBytes, window(RoleCopy)), s.CopyErr,
+		s.MetaCount, toRate(s.MetaCount, window(RoleMeta)), s.MetaErr, s.MetaCycles,
+		s.ListCount, toRate(s.ListCount, window(RoleList)), s.ListErr,
+		s.ListRowsCount, toRate(s.ListRowsCount, window(RoleList)),
+		s.DelCount, toRate(s.DelCount, window(RoleDel)), s.DelErr)
+	if s.Config.LockMode != `` {
+		fmt.Printf("LOCK %s %d days, %d retention extended (%d ERR), %d early deletes rejected, %d NOT REJECTED\n",
+			s.Config.LockMode, s.Config.LockDays, s.ExtendCount, s.ExtendErr, s.LockRejected, s.LockViolations)
+	}
+	if TLSHandshakes.Handshakes > 0 {
+		fmt.Println(`TLS `, TLSHandshakes.String())
+	}
 
-func (s *BenchmarkSuite) CreateBucket() {
-	client := s.CreateS3Client()
-	bucketName := s.Config.BucketName
-	in := &s3.CreateBucketInput{Bucket: aws.String(bucketName)}
-	if _, err := client.CreateBucket(in); err != nil {
-		log.Printf("WARNING: CreateBucket %s error, ignoring %v", bucketName, err)
+	if s.Config.StateFile != `` {
+		if err := s.WriteState(s.Config.StateFile); err != nil {
+			log.Printf(`WARNING: failed writing state file %s: %v`, s.Config.StateFile, err)
+		}
+	}
+
+	// solo = intervals where no other role was running
+	fmt.Println("\nROLE WINDOW          SOLO                           OVERLAPPING")
+	for role := 0; role < roleCount; role++ {
+		w := &s.Windows[role]
+		if w.Start == 0 {
+			continue
+		}
+		solo, overlap := s.RoleRates(role)
+		fmt.Printf("%-4s %5.1fs-%5.1fs  %-30s %s\n", roleNames[role],
+			float64(w.Start-begin.UnixNano())/1e9, float64(w.End-begin.UnixNano())/1e9, solo, overlap)
 	}
 }
 
-func (s *BenchmarkSuite) AveragePutDuration() (avg float64) {
-	for z := range s.Runner {
-		avg += float64(s.Runner[z].PutMillis)
+// Sample reads all counters at once
+func (s *BenchmarkSuite) Sample() (res Sample) {
+	res.At = time.Now()
+	res.Ops = [roleCount]int64{
+		atomic.LoadInt64(&s.PutCount),
+		atomic.LoadInt64(&s.GetCount),
+		atomic.LoadInt64(&s.HeadCount),
+		atomic.LoadInt64(&s.CopyCount),
+		atomic.LoadInt64(&s.MetaCount),
+		atomic.LoadInt64(&s.ListCount),
+		atomic.LoadInt64(&s.DelCount),
+	}
+	res.Bytes[RolePut] = atomic.LoadInt64(&s.PutBytes)
+	res.Bytes[RoleGet] = atomic.LoadInt64(&s.GetBytes)
+	res.Bytes[RoleCopy] = atomic.LoadInt64(&s.CopyBytes)
+	res.Errs = [roleCount]int64{
+		atomic.LoadInt64(&s.PutErr),
+		atomic.LoadInt64(&s.GetErr),
+		atomic.LoadInt64(&s.HeadErr),
+		atomic.LoadInt64(&s.CopyErr),
+		atomic.LoadInt64(&s.MetaErr),
+		atomic.LoadInt64(&s.ListErr),
+		atomic.LoadInt64(&s.DelErr),
 	}
-	avg /= float64(s.Config.GoPutCount)
-	avg /= 1e3 // millis to sec
+	res.Rows = atomic.LoadInt64(&s.ListRowsCount)
 	return
 }
 
-func (s *BenchmarkSuite) AverageGetDuration() (avg float64) {
-	for z := range s.Runner {
-		avg += float64(s.Runner[z].GetMillis)
+func (s *BenchmarkSuite) Interval(prev, cur Sample) (res Interval) {
+	res.Start, res.End = prev.At, cur.At
+	for role := 0; role < roleCount; role++ {
+		res.Ops[role] = cur.Ops[role] - prev.Ops[role]
+		res.Bytes[role] = cur.Bytes[role] - prev.Bytes[role]
 	}
-	avg /= float64(s.Config.GoGetCount)
-	avg /= 1e3 // millis to sec
 	return
 }
 
-func (s *BenchmarkSuite) AverageListDuration() (avg float64) {
-	for z := range s.Runner {
-		avg += float64(s.Runner[z].ListMillis)
+// RoleRates splits the intervals where role ran into running alone and overlapping with other roles,
+// another role only overlaps an interval when it ran more than half of it, samples are not aligned to role start/end
+func (s *BenchmarkSuite) RoleRates(role int) (solo, overlap RoleRate) {
+	for _, i := range s.Intervals {
+		if s.Windows[role].Overlap(i.Start, i.End) == 0 {
+			continue
+		}
+		alone := true
+		half := i.End.Sub(i.Start) / 2
+		for other := 0; other < roleCount; other++ {
+			if other != role && s.Windows[other].Overlap(i.Start, i.End) > half {
+				alone = false
+			}
+		}
+		if alone {
+			solo.Add(i, role, &s.Windows[role])
+		} else {
+			overlap.Add(i, role, &s.Windows[role])
+		}
 	}
-	avg /= float64(s.Config.GoListCount)
-	avg /= 1e3 // millis to sec
 	return
 }
 
-func (s *BenchmarkSuite) AverageDelDuration() (avg float64) {
-	for z := range s.Runner {
-		avg += float64(s.Runner[z].DelMillis)
+func (s *BenchmarkSuite) CreateBucket() {
+	client := s.CreateS3Client()
+	bucketName := s.Config.BucketName
+	in := &s3.CreateBucketInput{Bucket: aws.String(bucketName)}
+	if s.Config.LockMode != `` {
+		// can only be enabled on creation, also enables versioning
+		in.ObjectLockEnabledForBucket = aws.Bool(true)
+	}
+	if _, err := client.CreateBucket(in); err != nil {
+		log.Printf("WARNING: CreateBucket %s error, ignoring %v", bucketName, err)
+	}
+	if copyBucket := s.Config.CopyBucketName; s.Config.GoCopyCount > 0 && copyBucket != bucketName {
+		in := &s3.CreateBucketInput{Bucket: aws.String(copyBucket)}
+		if _, err := client.CreateBucket(in); err != nil {
+			log.Printf("WARNING: CreateBucket %s error, ignoring %v", copyBucket, err)
+		}
 	}
-	avg /= float64(s.Config.GoDelCount)
-	avg /= 1e3 // millis to sec
-	return
 }
 
 func (s *BenchmarkSuite) CreateUrl(objName string) string {
-	return s.Config.Endpoint + s.Config.BucketName + `/` + veeamPrefix + objName
+	return s.Config.Endpoint + s.Config.BucketName + `/` + s.Config.Pattern.Prefix + objName
+}
+
+// synthetic full backups are server-side copies of existing blocks
+const syntheticPrefix = `synthetic/`
+
+func (s *BenchmarkSuite) CreateCopyUrl(objName string) string {
+	return s.Config.Endpoint + s.Config.CopyBucketName + `/` + s.Config.Pattern.Prefix + syntheticPrefix + objName
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -525,15 +2064,19 @@ func (s *BenchmarkSuite) CreateUrl(objName string) string {
 
 type BenchmarkSteps struct {
 	PutSeed    Seed
-	PutMillis  uint64
-	GetMillis  uint64
-	ListMillis uint64
-	DelMillis  uint64
+	GetPicker  KeyPicker
+	HeadPicker KeyPicker
+	CopyPicker KeyPicker
+	ListPicker KeyPicker
+	MetaSeed   Seed
 
 	Suite     *BenchmarkSuite
 	Config    *BenchConfig
 	WaitGroup sync.WaitGroup
-	Objects   []string
+	// keys generated by PutSeed not yet written
+	Batch []string
+	// number of keys taken from PutSeed, verify regenerates this many
+	Generated int
 }
 
 func (r *BenchmarkSteps) Run(n int) {
@@ -549,15 +2092,26 @@ func (r *BenchmarkSteps) Run(n int) {
 	}
 
 	runGet := n < r.Config.GoGetCount
+	runHead := n < r.Config.GoHeadCount
+	runCopy := n < r.Config.GoCopyCount
+	runMeta := n < r.Config.GoMetaCount
 	runList := n < r.Config.GoListCount
 	runDel := n < r.Config.GoDelCount
 	runPut := n < r.Config.GoPutCount
 
-	r.WaitGroup.Add(bi(runGet) + bi(runList) + bi(runDel) + bi(runPut))
+	runExtend := runPut && r.Config.LockMode != ``
+
+	r.WaitGroup.Add(bi(runGet) + bi(runHead) + bi(runCopy) + bi(runMeta) + bi(runList) + bi(runDel) + bi(runPut) + bi(runExtend))
 
 	if runGet {
 		go r.RunGet(deltaDur)
 	}
+	if runHead {
+		go r.RunHead(deltaDur)
+	}
+	if runCopy {
+		go r.RunCopy(deltaDur)
+	}
 	if runList {
 		go r.RunList(2 * deltaDur)
 	}
@@ -567,31 +2121,43 @@ func (r *BenchmarkSteps) Run(n int) {
 	if runPut {
 		go r.RunPut()
 	}
+	if runMeta {
+		go r.RunMeta()
+	}
+	if runExtend {
+		go r.RunExtend(deltaDur, n)
+	}
 
 	r.WaitGroup.Wait()
 }
 
 func (r *BenchmarkSteps) RunPut() {
-	defer r.MarkDuration(time.Now(), &r.PutMillis)
+	defer r.MarkDuration(time.Now(), RolePut)
 
 	cli := r.Suite.CreateS3Client()
-	counter := 0
 	end := time.Now().Add(time.Duration(r.Config.DurationSeconds) * time.Second)
 
-	r.AppendObjects()
 	for time.Now().Before(end) {
 		atomic.AddInt64(&r.Suite.PutCount, 1)
-		fileobj := bytes.NewReader([]byte{})
-		for counter >= len(r.Objects) {
-			r.AppendObjects()
+		obj := r.NextObject()
+		pos := r.Suite.Pool.Add(obj)
+		objName := r.Suite.CreateUrl(obj)
+		size := r.ObjectSize(obj)
+		req, _ := http.NewRequest("PUT", objName, r.Payload(obj))
+		req.ContentLength = int64(size)
+		req.Header.Set("Content-Length", strconv.FormatUint(size, 10))
+		if r.Config.LockMode != `` {
+			req.Header.Set("Content-MD5", r.PayloadMd5(obj))
+			req.Header.Set("X-Amz-Object-Lock-Mode", r.Config.LockMode)
+			req.Header.Set("X-Amz-Object-Lock-Retain-Until-Date", r.RetainUntil().Format(time.RFC3339))
 		}
-		objName := r.Suite.CreateUrl(r.Objects[counter])
-		counter++
-		req, _ := http.NewRequest("PUT", objName, fileobj)
-		req.Header.Set("Content-Length", strconv.FormatUint(0, 10))
 		if resp, err := cli.Hit(req); err != nil {
 			log.Fatalf("FATAL: Error uploading object %s: %v", objName, err)
-		} else if resp != nil && resp.StatusCode != http.StatusOK {
+		} else if resp != nil && resp.StatusCode == http.StatusOK {
+			atomic.AddInt64(&r.Suite.PutBytes, int64(size))
+			r.Suite.Pool.Commit(pos, resp.Header.Get("X-Amz-Version-Id"))
+		} else if resp != nil {
+			r.Suite.Pool.Fail(pos)
 			if resp.StatusCode == http.StatusServiceUnavailable {
 				atomic.AddInt64(&r.Suite.PutErr, 1)
 				atomic.AddInt64(&r.Suite.PutCount, -1)
@@ -608,44 +2174,177 @@ func (r *BenchmarkSteps) RunPut() {
 
 func (r *BenchmarkSteps) RunGet(delay time.Duration) {
 	time.Sleep(delay)
-	defer r.MarkDuration(time.Now(), &r.GetMillis)
+	defer r.MarkDuration(time.Now(), RoleGet)
 
 	cli := r.Suite.CreateS3Client()
-	counter := 0
 	end := time.Now().Add(time.Duration(r.Config.DurationSeconds) * time.Second)
 
 	for time.Now().Before(end) {
-		if len(r.Objects) == 0 {
+		_, obj, ok := r.Suite.Pool.Pick(r.GetPicker)
+		if !ok {
 			time.Sleep(10 * time.Millisecond)
 			continue
 		}
 		atomic.AddInt64(&r.Suite.GetCount, 1)
 
-		//pos := rand.Int() % len(r.Objects) // if want random
-		pos := counter % len(r.Objects)
-		counter++
-		if counter < 0 {
-			counter = 0
-		}
-
-		objName := r.Suite.CreateUrl(r.Objects[pos])
+		objName := r.Suite.CreateUrl(obj)
 		req, _ := http.NewRequest("GET", objName, nil)
+		if blob := r.ReadRange(obj); blob != `` {
+			req.Header.Set("Range", blob)
+		}
 		if resp, err := cli.Hit(req); err != nil {
 			log.Fatalf("FATAL: Error downloading object %s: %v", objName, err)
 		} else if resp != nil && resp.Body != nil {
-			if resp.StatusCode == http.StatusServiceUnavailable {
+			switch resp.StatusCode {
+			case http.StatusOK, http.StatusPartialContent:
+				n, _ := io.Copy(ioutil.Discard, resp.Body)
+				atomic.AddInt64(&r.Suite.GetBytes, n)
+			case http.StatusNotFound:
+				atomic.AddInt64(&r.Suite.GetMiss, 1)
+				atomic.AddInt64(&r.Suite.GetCount, -1)
+			default:
 				atomic.AddInt64(&r.Suite.GetErr, 1)
 				atomic.AddInt64(&r.Suite.GetCount, -1)
+			}
+			_ = resp.Body.Close()
+		}
+	}
+}
+
+func (r *BenchmarkSteps) RunHead(delay time.Duration) {
+	time.Sleep(delay)
+	defer r.MarkDuration(time.Now(), RoleHead)
+
+	cli := r.Suite.CreateS3Client()
+	end := time.Now().Add(time.Duration(r.Config.DurationSeconds) * time.Second)
+
+	for time.Now().Before(end) {
+		_, obj, ok := r.Suite.Pool.Pick(r.HeadPicker)
+		if !ok {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		atomic.AddInt64(&r.Suite.HeadCount, 1)
+
+		objName := r.Suite.CreateUrl(obj)
+		req, _ := http.NewRequest("HEAD", objName, nil)
+		if resp, err := cli.Hit(req); err != nil {
+			log.Fatalf("FATAL: Error checking object %s: %v", objName, err)
+		} else if resp != nil {
+			if resp.Body != nil {
+				_ = resp.Body.Close()
+			}
+			if resp.StatusCode == http.StatusNotFound {
+				atomic.AddInt64(&r.Suite.HeadMiss, 1)
+				atomic.AddInt64(&r.Suite.HeadCount, -1)
+			} else if resp.StatusCode != http.StatusOK {
+				atomic.AddInt64(&r.Suite.HeadErr, 1)
+				atomic.AddInt64(&r.Suite.HeadCount, -1)
+			}
+		}
+	}
+}
+
+func (r *BenchmarkSteps) RunCopy(delay time.Duration) {
+	time.Sleep(delay)
+	defer r.MarkDuration(time.Now(), RoleCopy)
+
+	cli := r.Suite.CreateS3Client()
+	end := time.Now().Add(time.Duration(r.Config.DurationSeconds) * time.Second)
+
+	for time.Now().Before(end) {
+		// copy blocks in order like a synthetic full, wrap around when all copied
+		_, obj, ok := r.Suite.Pool.Pick(r.CopyPicker)
+		if !ok {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		atomic.AddInt64(&r.Suite.CopyCount, 1)
+
+		objName := r.Suite.CreateCopyUrl(obj)
+		req, _ := http.NewRequest("PUT", objName, nil)
+		req.Header.Set(`X-Amz-Copy-Source`, `/`+r.Config.BucketName+`/`+r.Config.Pattern.Prefix+obj)
+		if resp, err := cli.Hit(req); err != nil {
+			log.Fatalf("FATAL: Error copying object %s: %v", objName, err)
+		} else if resp != nil && resp.Body != nil {
+			// copy error can come after 200 status, inside the body
+			body, _ := ioutil.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || bytes.Contains(body, []byte(`<Error>`)) {
+				atomic.AddInt64(&r.Suite.CopyErr, 1)
+				atomic.AddInt64(&r.Suite.CopyCount, -1)
 			} else {
-				_, _ = io.Copy(ioutil.Discard, resp.Body)
+				atomic.AddInt64(&r.Suite.CopyBytes, int64(r.ObjectSize(obj)))
+			}
+		}
+	}
+}
+
+// RunMeta does what Veeam does around the blocks: check the repository owner,
+// take a lock, read-modify-write the backup metadata and checkpoints, release the lock
+func (r *BenchmarkSteps) RunMeta() {
+	defer r.MarkDuration(time.Now(), RoleMeta)
+
+	cli := r.Suite.CreateS3Client()
+	end := time.Now().Add(time.Duration(r.Config.DurationSeconds) * time.Second)
+	client, backup, metas := r.MetaSeed.NextVeeamMetaFiles(r.Config.MaxFolder2Capacity, r.Config.MaxFolder3Capacity)
+	generation := uint64(0)
+
+	hit := func(method, obj string, body bool) bool {
+		atomic.AddInt64(&r.Suite.MetaCount, 1)
+		objName := r.Suite.CreateUrl(obj)
+		var req *http.Request
+		if body {
+			// new content on every write
+			generation++
+			seed := ObjectSeed(r.Config.InitialSeed+generation, obj)
+			size := r.Config.MetaSizeDist.Size(seed.Next())
+			req, _ = http.NewRequest(method, objName, NewPayloadReader(seed, size, 90))
+			req.ContentLength = int64(size)
+		} else {
+			req, _ = http.NewRequest(method, objName, nil)
+		}
+		resp, err := cli.Hit(req)
+		if err != nil {
+			log.Fatalf("FATAL: Error %s metadata %s: %v", method, objName, err)
+		}
+		if resp.Body != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		if resp.StatusCode >= 300 {
+			atomic.AddInt64(&r.Suite.MetaErr, 1)
+			return false
+		}
+		return true
+	}
+
+	// initial repository state
+	hit("PUT", veeamOwner, true)
+	for _, obj := range metas {
+		hit("PUT", obj, true)
+	}
+
+	counter := 0
+	for time.Now().Before(end) {
+		hit("HEAD", veeamOwner, false)
+		lock := r.MetaSeed.NextVeeamLock(client, backup)
+		if hit("PUT", lock, true) {
+			hit("HEAD", lock, false)
+			obj := metas[counter%len(metas)]
+			counter++
+			if hit("GET", obj, false) {
+				hit("PUT", obj, true)
 			}
+			hit("DELETE", lock, false)
 		}
+		atomic.AddInt64(&r.Suite.MetaCycles, 1)
 	}
 }
 
 func (r *BenchmarkSteps) RunList(delay time.Duration) {
 	time.Sleep(delay)
-	defer r.MarkDuration(time.Now(), &r.ListMillis)
+	defer r.MarkDuration(time.Now(), RoleList)
 
 	cli := r.Suite.CreateS3Client()
 	end := time.Now().Add(time.Duration(r.Config.DurationSeconds) * time.Second)
@@ -654,41 +2353,32 @@ func (r *BenchmarkSteps) RunList(delay time.Duration) {
 	var prefix string
 
 	newPrefix := func() {
-		l := len(r.Objects)
-		if l <= 0 {
+		continuationToken = nil
+		_, obj, ok := r.Suite.Pool.Pick(r.ListPicker)
+		if !ok {
 			time.Sleep(10 * time.Millisecond)
 			return
 		}
 
-		pos := counter % l
 		counter++
 		if counter < 0 {
 			counter = 0
 		}
-		prefix = veeamPrefix
-		switch counter % 4 {
-		case 0:
-			prefix += S.LeftOf(r.Objects[pos], `/`)
-		case 1:
-			prefix += S.LeftOfLast(r.Objects[pos], `/`)
-		case 2:
-			suffix := S.LeftOfLast(S.LeftOfLast(r.Objects[pos], `/`), `/`)
-			prefix += suffix
-		}
+		prefix = r.Config.Pattern.Prefix + r.Config.Pattern.ListPrefix(obj, counter)
 	}
 	newPrefix()
 
 	for time.Now().Before(end) {
 		atomic.AddInt64(&r.Suite.ListCount, 1)
 
-		//pos := rand.Int() % len(r.Objects) // if want random
-
 		in := &s3.ListObjectsV2Input{
 			Bucket:            aws.String(r.Config.BucketName),
 			MaxKeys:           aws.Int64(1000),
 			Prefix:            &prefix,
 			ContinuationToken: continuationToken,
-			Delimiter:         aws.String(`/`),
+		}
+		if r.Config.Pattern.ListDelimiter != `` {
+			in.Delimiter = aws.String(r.Config.Pattern.ListDelimiter)
 		}
 		res, err := cli.ListObjectsV2(in)
 		if err != nil {
@@ -710,25 +2400,33 @@ func (r *BenchmarkSteps) RunList(delay time.Duration) {
 
 func (r *BenchmarkSteps) RunDel(delay time.Duration) {
 	time.Sleep(delay)
-	defer r.MarkDuration(time.Now(), &r.DelMillis)
+	defer r.MarkDuration(time.Now(), RoleDel)
 
 	cli := r.Suite.CreateS3Client()
-	counter := 0
 
 	end := time.Now().Add(time.Duration(r.Config.DurationSeconds) * time.Second)
 
 	for time.Now().Before(end) {
-		if counter >= len(r.Objects) {
+		// only objects which PUT already succeeded
+		pos, obj, versionId, ok := r.Suite.Pool.ClaimOldest()
+		if !ok {
 			time.Sleep(10 * time.Millisecond)
 			continue
 		}
-		objName := r.Suite.CreateUrl(r.Objects[counter])
-		counter++
+		if r.Config.LockMode != `` {
+			r.DeleteLocked(cli, pos, obj, versionId)
+			continue
+		}
+		if r.Config.Pattern.DeleteBatch > 0 {
+			r.DeleteBatch(cli, pos, obj)
+			continue
+		}
+		objName := r.Suite.CreateUrl(obj)
 		req, _ := http.NewRequest("DELETE", objName, nil)
 		if resp, err := cli.Hit(req); err != nil {
 			log.Fatalf("FATAL: Error deleting object %s: %v", objName, err)
 		} else if resp != nil && resp.StatusCode == http.StatusServiceUnavailable {
-			atomic.AddInt64(&r.Suite.DelCount, -1)
+			r.Suite.Pool.Restore(pos)
 			atomic.AddInt64(&r.Suite.DelErr, 1)
 		} else {
 			atomic.AddInt64(&r.Suite.DelCount, 1)
@@ -736,20 +2434,431 @@ func (r *BenchmarkSteps) RunDel(delay time.Duration) {
 	}
 }
 
-func (r *BenchmarkSteps) AppendObjects() {
-	newObjects := r.PutSeed.NextVeeamFiles(r.Config.MaxFolder1Capacity, r.Config.MaxFolder2Capacity, r.Config.MaxFolder3Capacity)
-	r.Objects = append(r.Objects, newObjects...)
+// DeleteBatch expires obj with the next oldest objects in one DeleteObjects request, keys failing are restored
+func (r *BenchmarkSteps) DeleteBatch(cli S3Client, pos int, obj string) {
+	positions := []int{pos}
+	del := &s3.Delete{Quiet: aws.Bool(true), Objects: []*s3.ObjectIdentifier{{Key: aws.String(r.Config.Pattern.Prefix + obj)}}}
+	for len(positions) < r.Config.Pattern.DeleteBatch {
+		pos, obj, _, ok := r.Suite.Pool.ClaimOldest()
+		if !ok {
+			break
+		}
+		positions = append(positions, pos)
+		del.Objects = append(del.Objects, &s3.ObjectIdentifier{Key: aws.String(r.Config.Pattern.Prefix + obj)})
+	}
+	res, err := cli.DeleteObjects(&s3.DeleteObjectsInput{Bucket: aws.String(r.Config.BucketName), Delete: del})
+	if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == http.StatusServiceUnavailable {
+		for _, pos := range positions {
+			r.Suite.Pool.Restore(pos)
+		}
+		atomic.AddInt64(&r.Suite.DelErr, int64(len(positions)))
+		return
+	} else if err != nil {
+		log.Fatalf("FATAL: Error deleting %d objects from %s: %v", len(positions), r.Config.BucketName, err)
+	}
+	// quiet mode only reports the keys that failed
+	failed := map[string]bool{}
+	for _, e := range res.Errors {
+		failed[aws.StringValue(e.Key)] = true
+	}
+	for z, pos := range positions {
+		if failed[*del.Objects[z].Key] {
+			r.Suite.Pool.Restore(pos)
+		}
+	}
+	atomic.AddInt64(&r.Suite.DelErr, int64(len(res.Errors)))
+	atomic.AddInt64(&r.Suite.DelCount, int64(len(positions)-len(res.Errors)))
+}
+
+// ReadRange is the Range header of a random blob in obj for patterns packing blobs into objects,
+// empty to read the whole object
+func (r *BenchmarkSteps) ReadRange(obj string) string {
+	if r.Config.Pattern.ReadRange == `` {
+		return ``
+	}
+	size := r.ObjectSize(obj)
+	length := r.Config.PatternReadRange.Size(rand.Uint64())
+	if length == 0 || length >= size {
+		return ``
+	}
+	offset := uint64(rand.Int63n(int64(size - length + 1)))
+	return fmt.Sprintf(`bytes=%d-%d`, offset, offset+length-1)
+}
+
+func (r *BenchmarkSteps) ObjectSize(obj string) uint64 {
+	seed := ObjectSeed(r.Config.InitialSeed, obj)
+	return r.Config.SizeDistOf(obj).Size(seed.Next())
+}
+
+// Payload is the deterministic content of an object, same seed gives same bytes
+func (r *BenchmarkSteps) Payload(obj string) io.Reader {
+	seed := ObjectSeed(r.Config.InitialSeed, obj)
+	size := r.Config.SizeDistOf(obj).Size(seed.Next())
+	return NewPayloadReader(seed, size, r.Config.Compressibility)
+}
+
+// PayloadMd5 is the base64 Content-MD5 of the payload, object lock requires it
+func (r *BenchmarkSteps) PayloadMd5(obj string) string {
+	h := md5.New()
+	_, _ = io.Copy(h, r.Payload(obj))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (r *BenchmarkSteps) RetainUntil() time.Time {
+	return time.Now().UTC().Add(time.Duration(r.Config.LockDays) * 24 * time.Hour)
+}
+
+// RunExtend pushes the retention of uploaded objects forward every -le seconds, like Veeam does,
+// PUT runner n extends every n-th object of the pool
+func (r *BenchmarkSteps) RunExtend(delay time.Duration, n int) {
+	time.Sleep(delay)
+	defer r.WaitGroup.Done()
+
+	cli := r.Suite.CreateS3Client()
+	interval := time.Duration(r.Config.LockExtendSeconds) * time.Second
+	end := time.Now().Add(time.Duration(r.Config.DurationSeconds) * time.Second)
+
+	for time.Now().Add(interval).Before(end) {
+		time.Sleep(interval)
+		until := r.RetainUntil()
+		keys, versionIds := r.Suite.Pool.ReadableVersions(r.Config.GoPutCount, n)
+		for z := 0; z < len(keys) && time.Now().Before(end); z++ {
+			obj, versionId := keys[z], versionIds[z]
+			if versionId == `` {
+				continue // not versioned
+			}
+			_, err := cli.PutObjectRetention(&s3.PutObjectRetentionInput{
+				Bucket:    aws.String(r.Config.BucketName),
+				Key:       aws.String(r.Config.Pattern.Prefix + obj),
+				VersionId: aws.String(versionId),
+				Retention: &s3.ObjectLockRetention{
+					Mode:            aws.String(r.Config.LockMode),
+					RetainUntilDate: aws.Time(until),
+				},
+			})
+			if err != nil {
+				atomic.AddInt64(&r.Suite.ExtendErr, 1)
+				continue
+			}
+			atomic.AddInt64(&r.Suite.ExtendCount, 1)
+		}
+	}
+}
+
+// DeleteLocked deletes the locked version, which must be rejected with AccessDenied before retention ends,
+// rejected objects are retained and not tried again and only counted as rejected, other errors are delete errors
+func (r *BenchmarkSteps) DeleteLocked(cli S3Client, pos int, obj, versionId string) {
+	if versionId == `` {
+		r.Suite.Pool.Retain(pos)
+		return // not versioned
+	}
+	_, err := cli.DeleteObject(&s3.DeleteObjectInput{
+		Bucket:    aws.String(r.Config.BucketName),
+		Key:       aws.String(r.Config.Pattern.Prefix + obj),
+		VersionId: aws.String(versionId),
+	})
+	if err != nil {
+		// only AccessDenied is the lock at work, other 403s like SignatureDoesNotMatch are errors,
+		// a rejected delete deleted nothing and is not a DEL operation
+		if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.Code() == `AccessDenied` {
+			r.Suite.Pool.Retain(pos)
+			atomic.AddInt64(&r.Suite.LockRejected, 1)
+			return
+		}
+		r.Suite.Pool.Restore(pos)
+		atomic.AddInt64(&r.Suite.DelErr, 1)
+		if reqErr, ok := err.(awserr.RequestFailure); !ok || reqErr.StatusCode() != http.StatusServiceUnavailable {
+			log.Printf(`WARNING: delete of locked object %s version %s failed: %v`, obj, versionId, err)
+		}
+		return
+	}
+	atomic.AddInt64(&r.Suite.DelCount, 1)
+	atomic.AddInt64(&r.Suite.LockViolations, 1)
+	log.Printf(`WARNING: locked object %s version %s was deleted before its retention date`, obj, versionId)
+}
+
+// NextObject is the next key of this runner, in the order the pattern writes them
+func (r *BenchmarkSteps) NextObject() string {
+	for len(r.Batch) == 0 {
+		r.Batch = r.Config.Pattern.NextFiles(&r.PutSeed, r.Config.MaxFolder1Capacity, r.Config.MaxFolder2Capacity, r.Config.MaxFolder3Capacity)
+	}
+	obj := r.Batch[0]
+	r.Batch = r.Batch[1:]
+	r.Generated++
+	return obj
 }
 
-func (r *BenchmarkSteps) MarkDuration(start time.Time, v *uint64) {
-	atomic.AddUint64(v, uint64(time.Now().Sub(start).Milliseconds()))
+func (r *BenchmarkSteps) MarkDuration(start time.Time, role int) {
+	r.Suite.Windows[role].Mark(start, time.Now())
 	defer r.WaitGroup.Done()
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// state file and verify
+
+// RunState is what verify needs besides the seed to know which keys should exist, no credentials
+type RunState struct {
+	BucketName         string
+	PatternName        string
+	KeyTemplate        string
+	InitialSeed        uint64
+	MaxFolder1Capacity uint16
+	MaxFolder2Capacity uint16
+	MaxFolder3Capacity uint16
+	LockMode           string
+	MetaRunners        int
+	// keys taken from PutSeed by each PUT runner
+	Generated []int
+	Failed    []string
+	Deleted   []string
+	Retained  []string
+}
+
+func (s *BenchmarkSuite) WriteState(fileName string) error {
+	b := s.Config
+	state := RunState{
+		BucketName:         b.BucketName,
+		PatternName:        b.PatternName,
+		KeyTemplate:        b.KeyTemplate,
+		InitialSeed:        b.InitialSeed,
+		MaxFolder1Capacity: b.MaxFolder1Capacity,
+		MaxFolder2Capacity: b.MaxFolder2Capacity,
+		MaxFolder3Capacity: b.MaxFolder3Capacity,
+		LockMode:           b.LockMode,
+		MetaRunners:        b.GoMetaCount,
+		Failed:             s.Pool.KeysIn(ObjectFailed),
+		Deleted:            s.Pool.KeysIn(ObjectDeleted),
+		Retained:           s.Pool.KeysIn(ObjectRetained),
+	}
+	for z := 0; z < b.GoPutCount; z++ {
+		state.Generated = append(state.Generated, s.Runner[z].Generated)
+	}
+	buf, err := json.MarshalIndent(state, ``, `  `)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, buf, 0644)
+}
+
+type Verifier struct {
+	Config BenchConfig
+	State  RunState
+	Method string
+}
+
+func (v *Verifier) ParseFromArgs(args []string) (string, int) {
+	if len(args) < 3 {
+		return `require endpoint, access, and secret key as first 3 arguments`, 2
+	}
+	b := &v.Config
+	b.SetDefaults()
+	b.SetCredentials(args[0], args[1], args[2])
+	v.Method = `list`
+	bucket := ``
+	for z := 3; z < len(args); z += 2 {
+		if z+1 >= len(args) {
+			return `require argument for ` + args[z], 3
+		}
+		switch args[z] {
+		case `-m`:
+			b.StateFile = args[z+1]
+		case `-b`:
+			bucket = args[z+1]
+		case `-vm`:
+			v.Method = args[z+1]
+		default:
+			b.SetFlag(args[z], args[z+1])
+		}
+	}
+	if v.Method != `list` && v.Method != `head` {
+		return `-vm must be list or head`, 3
+	}
+	if b.StateFile == `` {
+		return `require -m state file of the run`, 3
+	}
+	if errStr, exitCode := b.ApplyTransport(); exitCode != 0 {
+		return errStr, exitCode
+	}
+	buf, err := ioutil.ReadFile(b.StateFile)
+	if err != nil {
+		return err.Error(), 3
+	}
+	if err = json.Unmarshal(buf, &v.State); err != nil {
+		return `invalid state file: ` + err.Error(), 3
+	}
+	st := v.State
+	b.BucketName = st.BucketName
+	if bucket != `` {
+		b.BucketName = bucket
+	}
+	b.PatternName, b.KeyTemplate = st.PatternName, st.KeyTemplate
+	b.InitialSeed = st.InitialSeed
+	b.MaxFolder1Capacity, b.MaxFolder2Capacity, b.MaxFolder3Capacity = st.MaxFolder1Capacity, st.MaxFolder2Capacity, st.MaxFolder3Capacity
+	b.LockMode = st.LockMode
+	return b.LoadPattern()
+}
+
+// ExpectedKeys regenerates the keys of every PUT runner from the seed, and the metadata of every meta runner
+func (v *Verifier) ExpectedKeys() (keys []string) {
+	b := &v.Config
+	for z, count := range v.State.Generated {
+		seed := Seed(b.InitialSeed + uint64(z))
+		runnerKeys := []string{}
+		for len(runnerKeys) < count {
+			runnerKeys = append(runnerKeys, b.Pattern.NextFiles(&seed, b.MaxFolder1Capacity, b.MaxFolder2Capacity, b.MaxFolder3Capacity)...)
+		}
+		keys = append(keys, runnerKeys[:count]...)
+	}
+	if b.Pattern.Meta && v.State.MetaRunners > 0 {
+		keys = append(keys, veeamOwner)
+		for z := 0; z < v.State.MetaRunners; z++ {
+			seed := MetaSeed(b.InitialSeed, z)
+			_, _, metas := seed.NextVeeamMetaFiles(b.MaxFolder2Capacity, b.MaxFolder3Capacity)
+			keys = append(keys, metas...)
+		}
+	}
+	return
+}
+
+// Found is the keys present in the bucket, relative to pattern prefix, synthetic copies excluded,
+// failed is the keys whose HEAD failed with something else than 404
+func (v *Verifier) Found(cli S3Client, expected []string) (found map[string]bool, failed map[string]error, err error) {
+	b := &v.Config
+	found = map[string]bool{}
+	failed = map[string]error{}
+	if v.Method == `head` {
+		for _, key := range expected {
+			_, err := cli.HeadObject(&s3.HeadObjectInput{
+				Bucket: aws.String(b.BucketName),
+				Key:    aws.String(b.Pattern.Prefix + key),
+			})
+			if err == nil {
+				found[key] = true
+			} else if reqErr, ok := err.(awserr.RequestFailure); !ok || reqErr.StatusCode() != http.StatusNotFound {
+				failed[key] = err
+			}
+		}
+		return found, failed, nil
+	}
+	in := &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.BucketName),
+		Prefix: aws.String(b.Pattern.Prefix),
+	}
+	err = cli.ListObjectsV2Pages(in, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			key := S.RightOf(aws.StringValue(obj.Key), b.Pattern.Prefix)
+			if b.Pattern.Prefix == `` {
+				key = aws.StringValue(obj.Key)
+			}
+			if !S.StartsWith(key, syntheticPrefix) {
+				found[key] = true
+			}
+		}
+		return true
+	})
+	return
+}
+
+// Run prints the differences, returns exit code 9 when any
+func (v *Verifier) Run() int {
+	suite := BenchmarkSuite{Config: &v.Config}
+	cli := suite.CreateS3Client()
+	st := v.State
+
+	expected := v.ExpectedKeys()
+	gone := map[string]bool{}
+	for _, key := range st.Failed {
+		gone[key] = true
+	}
+	deleted := map[string]bool{}
+	for _, key := range st.Deleted {
+		deleted[key] = true
+	}
+	present := []string{}
+	written := map[string]bool{}
+	for _, key := range expected {
+		written[key] = true
+		if !gone[key] && !deleted[key] {
+			present = append(present, key)
+		}
+	}
+
+	found, failed, err := v.Found(cli, expected)
+	if err != nil {
+		log.Fatalf("FATAL: Error checking bucket %s: %v", v.Config.BucketName, err)
+	}
+
+	var missing, unexpected, afterDelete, errors []string
+	failure := func(key string) string {
+		if reqErr, ok := failed[key].(awserr.RequestFailure); ok {
+			return fmt.Sprintf(`%s: %d %s`, key, reqErr.StatusCode(), reqErr.Code())
+		}
+		return key + `: ` + failed[key].Error()
+	}
+	for _, key := range present {
+		if failed[key] != nil {
+			errors = append(errors, failure(key))
+		} else if !found[key] {
+			missing = append(missing, key)
+		}
+	}
+	unchecked := len(errors)
+	for _, key := range st.Deleted {
+		if failed[key] != nil {
+			errors = append(errors, failure(key))
+		} else if found[key] {
+			afterDelete = append(afterDelete, key)
+		}
+	}
+	for key := range found {
+		if !written[key] {
+			unexpected = append(unexpected, key)
+		}
+	}
+	sort.Strings(unexpected)
+
+	fmt.Printf("verify %s/%s (%s): %d keys regenerated from seed %d and %d runners, %d failed, %d deleted, %d retained by lock\n",
+		v.Config.BucketName, v.Config.Pattern.Prefix, v.Config.PatternName, len(expected), v.Config.InitialSeed, len(st.Generated),
+		len(st.Failed), len(st.Deleted), len(st.Retained))
+	fmt.Printf("%s found %d of %d expected objects\n", S.ToUpper(v.Method), len(present)-len(missing)-unchecked, len(present))
+	report := func(title string, keys []string) {
+		fmt.Printf("%-20s %d\n", title, len(keys))
+		for z := 0; z < len(keys) && z < 10; z++ {
+			fmt.Println(`  ` + keys[z])
+		}
+		if len(keys) > 10 {
+			fmt.Printf("  ... %d more\n", len(keys)-10)
+		}
+	}
+	report(`MISSING`, missing)
+	if v.Method == `list` {
+		// leftover locks of the metadata role show here too
+		report(`UNEXPECTED`, unexpected)
+	}
+	report(`PRESENT AFTER DELETE`, afterDelete)
+	if v.Method == `head` {
+		report(`ERRORS`, errors)
+	}
+	if len(missing)+len(unexpected)+len(afterDelete)+len(errors) > 0 {
+		return 9
+	}
+	return 0
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // main
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == `verify` {
+		v := Verifier{}
+		errStr, exitCode := v.ParseFromArgs(os.Args[2:])
+		if exitCode != 0 {
+			fmt.Println(exitCode, errStr)
+			os.Exit(exitCode)
+		}
+		os.Exit(v.Run())
+	}
+
 	// parse benchmark parameter
 	b := BenchConfig{}
 	b.SetDefaults()
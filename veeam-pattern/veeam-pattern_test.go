@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeyTemplateOverridesPattern(t *testing.T) {
+	for _, order := range [][]string{{`-t`, `backup/{seq4}[3]`, `-p`, `veeam`}, {`-p`, `veeam`, `-t`, `backup/{seq4}[3]`}} {
+		b := BenchConfig{}
+		b.SetDefaults()
+		args := append([]string{`http://127.0.0.1:9999`, `access`, `secret`}, order...)
+		if errStr, exitCode := b.ParseFromArgs(args); exitCode != 0 {
+			t.Fatalf(`%v: %s (%d)`, order, errStr, exitCode)
+		}
+		if b.PatternName != `template` {
+			t.Errorf(`%v: pattern %s, expected template`, order, b.PatternName)
+		}
+		seed := Seed(b.InitialSeed)
+		for _, key := range b.Pattern.NextFiles(&seed, 10, 10, 10) {
+			if !strings.HasPrefix(key, `backup/`) {
+				t.Errorf(`%v: key %s not from the template`, order, key)
+			}
+		}
+	}
+}